@@ -15,9 +15,92 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/getAll": {
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Публичные ключи для проверки подписи ID токенов",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oidc"
+                ],
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "Public keys",
+                        "schema": {
+                            "$ref": "#/definitions/auth.JSONWebKeySet"
+                        }
+                    }
+                }
+            }
+        },
+        "/.well-known/openid-configuration": {
+            "get": {
+                "description": "Метаданные OpenID Connect провайдера (OpenID Connect Discovery 1.0)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oidc"
+                ],
+                "summary": "OpenID Provider Configuration",
+                "responses": {
+                    "200": {
+                        "description": "Provider metadata",
+                        "schema": {
+                            "$ref": "#/definitions/response.DiscoveryResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/api-keys": {
             "get": {
-                "description": "Получение всех пользователей с пагинацией. Вспомогательный эндпоинт для более удобного тестирования",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Все API ключи со статистикой использования. Секреты не возвращаются. Доступно только администраторам с access token",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List API Keys",
+                "responses": {
+                    "200": {
+                        "description": "Keys",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.APIKey"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выпуск API ключа для интеграции. Ключ вида ` + "`" + `jtt_key_\u003cprefix\u003e_\u003csecret\u003e` + "`" + ` показывается один раз и передаётся в заголовке ` + "`" + `X-API-Key` + "`" + `.\nМожно ограничить ключ списком IP и CIDR. Доступно только администраторам с access token, не с PAT или API ключом",
                 "consumes": [
                     "application/json"
                 ],
@@ -25,44 +108,202 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "admin"
                 ],
-                "summary": "Get All Users",
+                "summary": "Create API Key",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "default": 1,
-                        "description": "Page number",
-                        "name": "page",
+                        "description": "API key",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.APIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created key",
+                        "schema": {
+                            "$ref": "#/definitions/response.APIKeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/api-keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отзыв API ключа, действует немедленно. Доступно только администраторам с access token",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Revoke API Key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Key revoked"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/audit-events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Журнал событий аутентификации с фильтрацией и курсорной пагинацией. Доступно только администраторам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get Audit Events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "user_guid",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "sign_in",
+                            "sign_up",
+                            "refresh",
+                            "ip_warning",
+                            "logout"
+                        ],
+                        "type": "string",
+                        "description": "Event type",
+                        "name": "event_type",
                         "in": "query"
                     },
                     {
+                        "type": "string",
+                        "description": "From (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "To (RFC3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor from previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 500,
+                        "minimum": 1,
                         "type": "integer",
-                        "default": 10,
-                        "description": "Number of users per page",
+                        "default": 50,
+                        "description": "Number of events per page",
                         "name": "limit",
                         "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successful response with user list",
+                        "description": "Successful response with audit events",
                         "schema": {
-                            "$ref": "#/definitions/response.UsersResponse"
+                            "$ref": "#/definitions/response.AuditEventsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/response.ErrorResponse"
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     }
                 }
             }
         },
-        "/refresh": {
+        "/admin/oauth/clients": {
             "post": {
-                "description": "Обновление токенов по паре access \u0026 refresh tokens.\nПри смене ip высылается email warning на почту указанную при создании и refresh токен в базе обнуляется.\nТокены были перенесены из headers в body для удобства отладки и проверки задания",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Регистрация OAuth клиента. Публичные клиенты (SPA, мобильные приложения) используют authorization code + PKCE,\nконфиденциальные получают client_secret, который показывается один раз. Доступно только администраторам",
                 "consumes": [
                     "application/json"
                 ],
@@ -70,170 +311,3053 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "admin"
                 ],
-                "summary": "Refresh JWT Tokens",
+                "summary": "Register OAuth Client",
                 "parameters": [
                     {
-                        "description": "Tokens Request",
-                        "name": "tokensRequest",
+                        "description": "Client",
+                        "name": "client",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/response.JwtResponse"
+                            "$ref": "#/definitions/request.OAuthClientRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Successful response with new tokens",
+                    "201": {
+                        "description": "Registered client",
                         "schema": {
-                            "$ref": "#/definitions/response.JwtResponse"
+                            "$ref": "#/definitions/response.OAuthClientResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request or tokens",
+                        "description": "Invalid client",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/response.ErrorResponse"
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     }
                 }
             }
         },
-        "/signIn": {
-            "post": {
-                "description": "Выдача access \u0026 refresh токенов по GUID user",
-                "consumes": [
-                    "application/json"
+        "/admin/users/{guid}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
                 ],
+                "description": "Получение пользователя по GUID. Доступно только администраторам",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "admin"
                 ],
-                "summary": "User Sign In",
+                "summary": "Get User",
                 "parameters": [
                     {
                         "type": "string",
                         "description": "User GUID",
                         "name": "guid",
-                        "in": "query",
+                        "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successful response",
+                        "description": "User",
                         "schema": {
-                            "$ref": "#/definitions/response.JwtResponse"
+                            "$ref": "#/definitions/response.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     },
                     "404": {
                         "description": "User not found",
                         "schema": {
-                            "$ref": "#/definitions/response.ErrorResponse"
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     }
                 }
-            }
-        },
-        "/signUp": {
-            "post": {
-                "description": "Создание пользователя по email",
-                "consumes": [
-                    "application/json"
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
                 ],
+                "description": "Мягкое удаление: пользователь получает статус deleted и исчезает из выдачи, окончательно он удаляется вместе с personal access tokens и привязками SSO через USER_RETENTION_DAYS. Записи аудита сохраняются. Доступно только администраторам",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "admin"
                 ],
-                "summary": "User Sign Up",
+                "summary": "Delete User",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "User Email",
-                        "name": "email",
-                        "in": "query",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "User created successfully"
+                    "204": {
+                        "description": "User deleted"
                     },
                     "400": {
-                        "description": "Email is required",
+                        "description": "Invalid GUID",
                         "schema": {
-                            "$ref": "#/definitions/response.ErrorResponse"
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     },
                     "404": {
                         "description": "User not found",
                         "schema": {
-                            "$ref": "#/definitions/response.ErrorResponse"
+                            "$ref": "#/definitions/response.ProblemResponse"
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "domain.User": {
-            "type": "object",
-            "properties": {
-                "email": {
-                    "type": "string"
-                },
-                "guid": {
-                    "type": "string"
-                },
-                "refresh_token": {
-                    "type": "string"
-                }
-            }
-        },
-        "response.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string"
-                }
-            }
-        },
-        "response.JwtResponse": {
-            "type": "object",
-            "properties": {
-                "access_token": {
-                    "type": "string"
-                },
-                "refresh_token": {
-                    "type": "string"
-                }
-            }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Смена email пользователя. Новый адрес считается неподтверждённым. Доступно только администраторам",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Update User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New email",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.UpdateUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated user",
+                        "schema": {
+                            "$ref": "#/definitions/response.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid GUID or email",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email already registered",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{guid}/disable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Отключение учётной записи: все refresh сессии отзываются, вход и обновление токенов запрещены до включения. Доступно только администраторам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Disable User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "User disabled"
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden or own account",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{guid}/enable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Включение отключённой учётной записи. Доступно только администраторам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Enable User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "User enabled"
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{guid}/logout": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Принудительный выход: все refresh сессии пользователя отзываются, выданный access token действует до истечения срока. Доступно только администраторам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Force Logout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Refresh token revoked"
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{guid}/unlock": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Снятие блокировки со всех refresh сессий пользователя после неудачных попыток обновления токенов и сброс счётчиков. Доступно только администраторам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Unlock User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "User unlocked"
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Профиль текущего пользователя",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "Get Profile",
+                "responses": {
+                    "200": {
+                        "description": "User",
+                        "schema": {
+                            "$ref": "#/definitions/response.UserResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаление собственной учётной записи. Удаление мягкое, как и DELETE /admin/users/{guid}: войти больше нельзя,\nданные удаляются окончательно через USER_RETENTION_DAYS",
+                "tags": [
+                    "me"
+                ],
+                "summary": "Delete Account",
+                "responses": {
+                    "204": {
+                        "description": "Account deleted"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Token was not issued by sign in",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me/activity": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "События безопасности текущего пользователя из журнала аудита (входы, обновления токенов, смена IP, блокировки и т.д.), новые первыми",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "Get Security Activity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cursor from previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 100,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Number of events per page",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Security events",
+                        "schema": {
+                            "$ref": "#/definitions/response.ActivityResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid cursor or limit",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me/email": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Запрос на смену email: на новый адрес отправляется код подтверждения, на старый — уведомление.\nEmail меняется только после POST /api/v1/me/email/confirm, код действует 24 часа",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "Change Email",
+                "parameters": [
+                    {
+                        "description": "New email",
+                        "name": "email",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.EmailChangeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Verification code sent",
+                        "schema": {
+                            "$ref": "#/definitions/response.EmailChangeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid email",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Token was not issued by sign in",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email already registered",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/me/email/confirm": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Подтверждение нового email кодом из письма. Новый адрес считается подтверждённым",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "me"
+                ],
+                "summary": "Confirm Email Change",
+                "parameters": [
+                    {
+                        "description": "Verification code",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.EmailConfirmRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated user",
+                        "schema": {
+                            "$ref": "#/definitions/response.UserResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid or expired code",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Token was not issued by sign in",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email already registered",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/sessions": {
+            "post": {
+                "description": "Выдача access \u0026 refresh токенов по GUID user.\nПри delivery=cookie refresh token выставляется в HttpOnly cookie для /api/v1/tokens вместе с CSRF cookie, в body возвращается только access token",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Create Session",
+                "parameters": [
+                    {
+                        "description": "User GUID and delivery mode",
+                        "name": "session",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.SignInRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof JWT: binds issued tokens to the client key (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response",
+                        "schema": {
+                            "$ref": "#/definitions/response.JwtResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "Account locked",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until the next request is allowed"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tokens": {
+            "post": {
+                "description": "Обновление токенов по паре access \u0026 refresh tokens.\nПри смене ip высылается email warning на почту указанную при создании и refresh токен в базе обнуляется.\nТокены передаются в JSON body, access token также принимается в ` + "`" + `Authorization: Bearer` + "`" + `, refresh token — в заголовке X-Refresh-Token\nили form-encoded body ` + "`" + `grant_type=refresh_token\u0026refresh_token=...` + "`" + ` (RFC 6749, раздел 6).\nЕсли refresh token не передан, он берётся из cookie, выставленной POST /api/v1/sessions с delivery=cookie. В этом случае обязателен заголовок X-CSRF-Token со значением cookie csrf_token,\nновый refresh token снова выставляется в cookie, а в body возвращается только access token",
+                "consumes": [
+                    "application/json",
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Refresh JWT Tokens",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer access token",
+                        "name": "Authorization",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Refresh token",
+                        "name": "X-Refresh-Token",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Tokens",
+                        "name": "tokensRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/request.RefreshRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "CSRF token from csrf_token cookie (cookie mode only)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof JWT, required for DPoP-bound tokens (Authorization: DPoP \u003ctoken\u003e)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response with new tokens",
+                        "schema": {
+                            "$ref": "#/definitions/response.JwtResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid, expired or mismatched tokens",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "CSRF token mismatch",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "Account locked",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until the next request is allowed"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Получение пользователей с фильтрами, сортировкой и курсорной пагинацией, только для администраторов.\nСекретные поля (хеш refresh token, привязки токенов) не возвращаются, fields=guid,email ограничивает набор полей в ответе.\nnext_cursor передаётся в cursor для следующей страницы с той же сортировкой, total считается только при include_total=true",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "List Users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Email contains (case-insensitive)",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC3339)",
+                        "name": "created_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC3339)",
+                        "name": "created_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Has an unexpired refresh session",
+                        "name": "has_active_session",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Email verified",
+                        "name": "verified",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "active",
+                            "disabled",
+                            "pending",
+                            "deleted"
+                        ],
+                        "type": "string",
+                        "description": "Account status, deleted users are excluded unless status=deleted",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "created_at",
+                            "-created_at",
+                            "email",
+                            "-email"
+                        ],
+                        "type": "string",
+                        "default": "-created_at",
+                        "description": "Sort key, '-' for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor from previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 100,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Number of users per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Count users matching filters",
+                        "name": "include_total",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields: guid, email, email_verified, role, locked_until, status, created_at",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response with user list",
+                        "schema": {
+                            "$ref": "#/definitions/response.UserListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter, sort, cursor or fields",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Создание пользователя по email",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Create User",
+                "parameters": [
+                    {
+                        "description": "User email",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.SignUpRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "User created successfully"
+                    },
+                    "400": {
+                        "description": "Invalid email",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email already registered",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until the next request is allowed"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/authorize": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выдача authorization code для authorization code flow с обязательным PKCE (S256).\nБраузер аутентифицируется cookie сессии из /login, без неё перенаправляется на /login и возвращается сюда после входа.\nAccess token в заголовке Authorization тоже принимается. После проверки выполняется redirect на redirect_uri с code и state",
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "OAuth 2.0 Authorization Endpoint",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Must be code",
+                        "name": "response_type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "client_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Registered redirect URI",
+                        "name": "redirect_uri",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Space separated scopes",
+                        "name": "scope",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Opaque client state",
+                        "name": "state",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "PKCE code challenge",
+                        "name": "code_challenge",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "S256"
+                        ],
+                        "type": "string",
+                        "description": "PKCE method",
+                        "name": "code_challenge_method",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Redirect to redirect_uri with code or error, or to /login without a session"
+                    },
+                    "400": {
+                        "description": "Invalid client or redirect_uri",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/device": {
+            "get": {
+                "description": "HTML страница verification_uri: пользователь вводит user_code и подтверждает или отклоняет устройство.\nБез cookie сессии браузер перенаправляется на /login",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Device Verification Page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User code from verification_uri_complete",
+                        "name": "user_code",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Verification form"
+                    },
+                    "302": {
+                        "description": "Redirect to /login without a session"
+                    }
+                }
+            },
+            "post": {
+                "description": "Отправка формы страницы /device: сохраняет решение пользователя по user_code",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Confirm Device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User code",
+                        "name": "user_code",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Approve or deny",
+                        "name": "approve",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Value of the csrf_token cookie",
+                        "name": "csrf_token",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Decision saved"
+                    },
+                    "400": {
+                        "description": "Invalid form"
+                    },
+                    "404": {
+                        "description": "Invalid or expired user code"
+                    }
+                }
+            }
+        },
+        "/device/verify": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Подтверждение или отклонение user_code устройства авторизованным пользователем через API. Браузеры используют страницу GET /device",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Approve Device",
+                "parameters": [
+                    {
+                        "description": "User code and decision",
+                        "name": "verification",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.DeviceVerificationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Decision saved"
+                    },
+                    "400": {
+                        "description": "Invalid or expired user code",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/device_authorization": {
+            "post": {
+                "description": "Выдача device_code и user_code для устройств без браузера (RFC 8628).\nПользователь вводит user_code на verification_uri, устройство опрашивает /token",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "OAuth 2.0 Device Authorization Endpoint",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client ID (if not sent via HTTP Basic)",
+                        "name": "client_id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client secret for confidential clients",
+                        "name": "client_secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Requested scopes",
+                        "name": "scope",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Device and user codes",
+                        "schema": {
+                            "$ref": "#/definitions/response.DeviceAuthorizationResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "OAuth error",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid client",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/getAll": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Устаревший вариант GET /api/v1/users с постраничной выдачей по номеру страницы, только для администраторов",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get All Users",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 1,
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 100,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Number of users per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated fields: guid, email, email_verified, role, locked_until, status, created_at",
+                        "name": "fields",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response with user list",
+                        "schema": {
+                            "$ref": "#/definitions/response.UsersResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid page, limit or fields",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/login": {
+            "get": {
+                "description": "HTML форма входа. На неё перенаправляют /authorize и /device, если у браузера нет сессии",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Login Page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Local path to return to after sign in",
+                        "name": "return_to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Login form"
+                    }
+                }
+            },
+            "post": {
+                "description": "Вход из HTML формы: выставляет HttpOnly cookie session с access token и перенаправляет на return_to.\nRefresh token не выдаётся, сессии приложений пользователя не затрагиваются",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "Login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Local path to return to after sign in",
+                        "name": "return_to",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Value of the csrf_token cookie",
+                        "name": "csrf_token",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "303": {
+                        "description": "Redirect to return_to"
+                    },
+                    "400": {
+                        "description": "Invalid form"
+                    },
+                    "401": {
+                        "description": "Sign in failed"
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/logout": {
+            "get": {
+                "description": "Завершение сессии по id_token_hint: refresh сессии пользователя у этого клиента отзываются, cookie сессии /login удаляется.\npost_logout_redirect_uri должен входить в redirect_uris клиента",
+                "tags": [
+                    "oidc"
+                ],
+                "summary": "OIDC End Session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Previously issued ID token",
+                        "name": "id_token_hint",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "client_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Redirect after logout",
+                        "name": "post_logout_redirect_uri",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Opaque client state",
+                        "name": "state",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Session ended"
+                    },
+                    "302": {
+                        "description": "Redirect to post_logout_redirect_uri"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Счётчики доменных событий с момента запуска сервиса. Доступно только администраторам, отключается METRICS_ENABLED=false",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Event Metrics",
+                "responses": {
+                    "200": {
+                        "description": "Event counters",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/personal-tokens": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Токены текущего пользователя, включая отозванные и истёкшие. Сами токены не возвращаются",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tokens"
+                ],
+                "summary": "List Personal Access Tokens",
+                "responses": {
+                    "200": {
+                        "description": "Tokens",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.PersonalAccessToken"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выпуск долгоживущего токена для скриптов. Токен показывается один раз и передаётся как ` + "`" + `Authorization: Bearer jtt_pat_...` + "`" + `.\nScope ` + "`" + `admin` + "`" + ` доступен только администраторам. Создать токен можно только с access token активного пользователя, не с PAT или API ключом",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tokens"
+                ],
+                "summary": "Create Personal Access Token",
+                "parameters": [
+                    {
+                        "description": "Token",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/request.PersonalAccessTokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created token",
+                        "schema": {
+                            "$ref": "#/definitions/response.PersonalAccessTokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden or account disabled",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/personal-tokens/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отзыв токена текущего пользователя, действует немедленно",
+                "tags": [
+                    "tokens"
+                ],
+                "summary": "Revoke Personal Access Token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Token ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Token revoked"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Token not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/refresh": {
+            "post": {
+                "description": "Устаревший вариант POST /api/v1/tokens. Передача обоих токенов в JSON body здесь отключается REFRESH_BODY_FALLBACK=false,\ncookie режим работает с cookie, выставленной устаревшим /signIn",
+                "consumes": [
+                    "application/json",
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Refresh JWT Tokens",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer access token",
+                        "name": "Authorization",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Refresh token",
+                        "name": "X-Refresh-Token",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Tokens in body (fallback mode)",
+                        "name": "tokensRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/request.RefreshRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "CSRF token from csrf_token cookie (cookie mode only)",
+                        "name": "X-CSRF-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof JWT, required for DPoP-bound tokens (Authorization: DPoP \u003ctoken\u003e)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response with new tokens",
+                        "schema": {
+                            "$ref": "#/definitions/response.JwtResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid, expired or mismatched tokens",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "CSRF token mismatch",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "Account locked",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until the next request is allowed"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/signIn": {
+            "post": {
+                "description": "Устаревший вариант POST /api/v1/sessions: GUID передаётся в query string и попадает в логи.\nОтключается LEGACY_ROUTES_ENABLED=false, ответ содержит заголовки Deprecation, Sunset и Link на новый эндпоинт",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "User Sign In",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User GUID",
+                        "name": "guid",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "body",
+                            "cookie"
+                        ],
+                        "type": "string",
+                        "default": "body",
+                        "description": "Token delivery mode",
+                        "name": "delivery",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof JWT: binds issued tokens to the client key (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful response",
+                        "schema": {
+                            "$ref": "#/definitions/response.JwtResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid GUID",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "423": {
+                        "description": "Account locked",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until the next request is allowed"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/signUp": {
+            "post": {
+                "description": "Устаревший вариант POST /api/v1/users: email передаётся в query string",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "User Sign Up",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User Email",
+                        "name": "email",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "User created successfully"
+                    },
+                    "400": {
+                        "description": "Invalid email",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email already registered",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds until the next request is allowed"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/sso/{provider}/callback": {
+            "get": {
+                "description": "Обменивает код провайдера на ID токен, находит, создаёт или привязывает пользователя, выставляет HttpOnly cookie session,\nкак /login, и перенаправляет на return_to. При первом входе учётная запись привязывается по подтверждённому email",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "sso"
+                ],
+                "summary": "Завершение входа через внешнего провайдера",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "State from login redirect",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code from provider",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signed in"
+                    },
+                    "303": {
+                        "description": "Redirect to return_to"
+                    },
+                    "400": {
+                        "description": "Invalid callback",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Account cannot be linked",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/sso/{provider}/link": {
+            "get": {
+                "description": "Привязывает внешнюю учётную запись к пользователю текущей сессии после входа у провайдера.\nТак привязываются существующие учётные записи с неподтверждённым email. Без сессии браузер перенаправляется на /login",
+                "tags": [
+                    "sso"
+                ],
+                "summary": "Привязка внешнего провайдера",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Local path to return to after linking",
+                        "name": "return_to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Redirect to provider"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Unknown provider",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/sso/{provider}/login": {
+            "get": {
+                "description": "Перенаправляет на страницу авторизации внешнего OIDC провайдера. State сохраняется в HttpOnly cookie sso_state:\ncallback принимается только в том же браузере",
+                "tags": [
+                    "sso"
+                ],
+                "summary": "Вход через внешнего провайдера",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Provider name",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Local path to return to after sign in",
+                        "name": "return_to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Redirect to provider"
+                    },
+                    "404": {
+                        "description": "Unknown provider",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/token": {
+            "post": {
+                "description": "authorization_code: обмен authorization code и code_verifier на пару access \u0026 refresh токенов.\nclient_credentials: access token для сервисов без пользователя, subject токена — client_id.\ndevice_code: опрос устройством, пока пользователь не подтвердит user_code (authorization_pending, slow_down).\ntoken-exchange: обмен access token пользователя на более узкий токен для другого сервиса с claim act (RFC 8693).\nКонфиденциальные клиенты аутентифицируются через HTTP Basic или client_id \u0026 client_secret в форме",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oauth"
+                ],
+                "summary": "OAuth 2.0 Token Endpoint",
+                "parameters": [
+                    {
+                        "enum": [
+                            "authorization_code",
+                            "client_credentials",
+                            "urn:ietf:params:oauth:grant-type:device_code",
+                            "urn:ietf:params:oauth:grant-type:token-exchange"
+                        ],
+                        "type": "string",
+                        "description": "Grant type",
+                        "name": "grant_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Redirect URI used in /authorize",
+                        "name": "redirect_uri",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client ID (if not sent via HTTP Basic)",
+                        "name": "client_id",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client secret (if not sent via HTTP Basic)",
+                        "name": "client_secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "PKCE code verifier",
+                        "name": "code_verifier",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Requested scopes for client_credentials",
+                        "name": "scope",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Device code for device flow polling",
+                        "name": "device_code",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token exchange: access token of the subject, or user GUID for impersonation",
+                        "name": "subject_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token exchange: urn:ietf:params:oauth:token-type:access_token or urn:jwttesttask:params:oauth:token-type:user_guid",
+                        "name": "subject_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token exchange: access token of the impersonating admin",
+                        "name": "actor_token",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token exchange: urn:ietf:params:oauth:token-type:access_token",
+                        "name": "actor_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token exchange: target service",
+                        "name": "audience",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token exchange: requested token type",
+                        "name": "requested_token_type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "DPoP proof JWT: binds issued tokens to the client key (RFC 9449)",
+                        "name": "DPoP",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Issued tokens",
+                        "schema": {
+                            "$ref": "#/definitions/response.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "OAuth error",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid client",
+                        "schema": {
+                            "$ref": "#/definitions/response.OAuthErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/userinfo": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Claims пользователя, которому выдан access token",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "oidc"
+                ],
+                "summary": "OIDC UserInfo",
+                "responses": {
+                    "200": {
+                        "description": "User claims",
+                        "schema": {
+                            "$ref": "#/definitions/response.UserInfoResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/response.ProblemResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "auth.JSONWebKey": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "e": {
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string"
+                },
+                "kty": {
+                    "type": "string"
+                },
+                "n": {
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.JSONWebKeySet": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/auth.JSONWebKey"
+                    }
+                }
+            }
+        },
+        "domain.APIKey": {
+            "type": "object",
+            "properties": {
+                "allowed_ips": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "last_used_ip": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "string"
+                },
+                "usage_count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.AuditEvent": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "prev_hash": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "result": {
+                    "type": "string"
+                },
+                "seq": {
+                    "type": "integer"
+                },
+                "user_agent": {
+                    "type": "string"
+                },
+                "user_guid": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.PersonalAccessToken": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "hint": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                }
+            }
+        },
+        "request.APIKeyRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "allowed_ips": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "expires_in_days": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "request.DeviceVerificationRequest": {
+            "type": "object",
+            "required": [
+                "user_code"
+            ],
+            "properties": {
+                "approve": {
+                    "type": "boolean"
+                },
+                "user_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "request.EmailChangeRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "maxLength": 254
+                }
+            }
+        },
+        "request.EmailConfirmRequest": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "maxLength": 64
+                }
+            }
+        },
+        "request.OAuthClientRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "redirect_uris"
+            ],
+            "properties": {
+                "access_token_ttl": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "audiences": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "confidential": {
+                    "type": "boolean"
+                },
+                "grant_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "redirect_uris": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tls_client_auth_subject_dn": {
+                    "type": "string"
+                }
+            }
+        },
+        "request.PersonalAccessTokenRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "expires_in_days": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "request.RefreshRequest": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "request.SignInRequest": {
+            "type": "object",
+            "required": [
+                "guid"
+            ],
+            "properties": {
+                "delivery": {
+                    "type": "string",
+                    "enum": [
+                        "body",
+                        "cookie"
+                    ]
+                },
+                "guid": {
+                    "type": "string"
+                }
+            }
+        },
+        "request.SignUpRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "maxLength": 254
+                }
+            }
+        },
+        "request.UpdateUserRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "maxLength": 254
+                }
+            }
+        },
+        "response.APIKeyResponse": {
+            "type": "object",
+            "properties": {
+                "allowed_ips": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "last_used_ip": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "string"
+                },
+                "usage_count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "response.ActivityEvent": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "result": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.ActivityResponse": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/response.ActivityEvent"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.AuditEventsResponse": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.AuditEvent"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                }
+            }
         },
-        "response.UsersResponse": {
+        "response.DeviceAuthorizationResponse": {
             "type": "object",
             "properties": {
-                "limit": {
+                "device_code": {
+                    "type": "string"
+                },
+                "expires_in": {
                     "type": "integer"
                 },
-                "page": {
+                "interval": {
+                    "type": "integer"
+                },
+                "user_code": {
+                    "type": "string"
+                },
+                "verification_uri": {
+                    "type": "string"
+                },
+                "verification_uri_complete": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.DiscoveryResponse": {
+            "type": "object",
+            "properties": {
+                "authorization_endpoint": {
+                    "type": "string"
+                },
+                "claims_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "code_challenge_methods_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "device_authorization_endpoint": {
+                    "type": "string"
+                },
+                "dpop_signing_alg_values_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "end_session_endpoint": {
+                    "type": "string"
+                },
+                "grant_types_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id_token_signing_alg_values_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "issuer": {
+                    "type": "string"
+                },
+                "jwks_uri": {
+                    "type": "string"
+                },
+                "response_types_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "scopes_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "subject_types_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tls_client_certificate_bound_access_tokens": {
+                    "type": "boolean"
+                },
+                "token_endpoint": {
+                    "type": "string"
+                },
+                "token_endpoint_auth_methods_supported": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "userinfo_endpoint": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.EmailChangeResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "pending_email": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.JwtResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.OAuthClientResponse": {
+            "type": "object",
+            "properties": {
+                "access_token_ttl": {
+                    "type": "integer"
+                },
+                "audiences": {
+                    "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "client_secret": {
+                    "type": "string"
+                },
+                "confidential": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "grant_types": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "redirect_uris": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "string"
+                },
+                "tls_client_auth_subject_dn": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.OAuthErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "error_description": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.PersonalAccessTokenResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "hint": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.ProblemResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors заполняется при ошибках валидации: по одной записи на поле.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/response.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.TokenResponse": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "id_token": {
+                    "type": "string"
+                },
+                "issued_token_type": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.UserInfoResponse": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "email_verified": {
+                    "type": "boolean"
+                },
+                "sub": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.UserListResponse": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Total возвращается только при include_total=true.",
                     "type": "integer"
                 },
-                "songs": {
+                "users": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/domain.User"
+                        "$ref": "#/definitions/response.UserResponse"
                     }
+                }
+            }
+        },
+        "response.UserResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                },
+                "email_verified": {
+                    "type": "boolean"
+                },
+                "guid": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "response.UsersResponse": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "page": {
+                    "type": "integer"
                 },
                 "total": {
                     "type": "integer"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/response.UserResponse"
+                    }
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "APIKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -3,18 +3,38 @@ package main
 import (
 	_ "JwtTestTask/docs"
 	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
 	"JwtTestTask/src/internal/repository"
 	"JwtTestTask/src/internal/routing"
 	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/internal/subscriber"
 	"JwtTestTask/src/pkg/auth"
 	"JwtTestTask/src/pkg/config"
 	"JwtTestTask/src/pkg/database"
+	"JwtTestTask/src/pkg/dpop"
 	"JwtTestTask/src/pkg/logger"
+	"JwtTestTask/src/pkg/mail"
+	"JwtTestTask/src/pkg/mtls"
+	"JwtTestTask/src/pkg/ratelimit"
+	"JwtTestTask/src/pkg/sso"
+	"flag"
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"net/http"
+	"os"
+	"time"
 )
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
+	verifyAudit := flag.Bool("verify-audit", false, "проверить целостность цепочки журнала аудита и завершить работу")
+	flag.Parse()
+
 	logger.Init()
 	config.Init()
 
@@ -23,25 +43,105 @@ func main() {
 	logger.Log.Infoln("Database connection established")
 
 	jwtModel := config.GetJwtParams()
-	jwtManager, err := auth.NewManager(jwtModel.SigningKey, jwtModel.AccessDuration, jwtModel.RefreshDuration)
+	oidcModel := config.GetOIDCParams()
+	jwtManager, err := auth.NewManager(jwtModel.SigningKey, oidcModel.Issuer, jwtModel.AccessDuration, jwtModel.RefreshDuration)
 
 	if err != nil {
 		logger.Log.Errorln(err.Error())
 	}
 
+	bus := event.NewBus()
+	mailer := mail.NewSender()
+	subscriber.NewEmailNotifier(mailer).Register(bus)
+	subscriber.NewAuditLogger().Register(bus)
+	metrics := subscriber.NewMetrics()
+	metrics.Register(bus)
+	if webhookURL := config.GetWebhookParams().URL; webhookURL != "" {
+		subscriber.NewWebhook(webhookURL).Register(bus)
+	}
+
 	userRepository := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepository, jwtManager)
+	userService := service.NewUserService(userRepository, repository.NewSessionRepository(db), jwtManager, bus, config.GetLockoutParams(), mailer)
 
-	err = db.AutoMigrate(&domain.User{})
+	auditRepository := repository.NewAuditRepository(db)
+	auditService := service.NewAuditService(auditRepository, jwtManager)
+	auditService.Register(bus)
+
+	oauthRepository := repository.NewOAuthRepository(db)
+	idTokenSigner, err := auth.NewIDTokenSigner(oidcModel.PrivateKeyPath, oidcModel.Issuer)
+	if err != nil {
+		logger.Log.Fatal("Ошибка загрузки ключа OIDC:", err)
+	}
+	oauthService := service.NewOAuthService(oauthRepository, userService, idTokenSigner, oidcModel.IDTokenDuration)
+	oidcService := service.NewOIDCService(oauthService)
+
+	ssoHTTPClient := &http.Client{Timeout: 10 * time.Second}
+	var ssoProviders []sso.ProviderInterface
+	for _, providerConfig := range config.GetSSOParams() {
+		ssoProviders = append(ssoProviders, sso.NewProvider(providerConfig, ssoHTTPClient))
+	}
+	ssoService := service.NewSSOService(ssoProviders, repository.NewIdentityRepository(db), userService)
+
+	tokenService := service.NewTokenService(repository.NewTokenRepository(db), userService)
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(db), bus)
+	authenticator := service.NewAuthenticator(jwtManager, tokenService, apiKeyService)
+
+	err = db.AutoMigrate(&domain.User{}, &domain.AuditEvent{}, &domain.AuditCheckpoint{}, &domain.OAuthClient{}, &domain.AuthorizationCode{}, &domain.DeviceCode{}, &domain.ExternalIdentity{}, &domain.PersonalAccessToken{}, &domain.APIKey{}, &domain.RefreshSession{})
+	if err == nil {
+		err = userRepository.MigrateLegacyColumns()
+	}
 	if err != nil {
 		logger.Log.Fatal("Ошибка миграции:", err)
 	} else {
 		logger.Log.Infoln("Успешная миграция.")
 	}
 
+	if *verifyAudit {
+		chainBreak, err := auditService.VerifyChain()
+		if err != nil {
+			logger.Log.Fatal("Ошибка проверки журнала аудита:", err)
+		}
+		if chainBreak != nil {
+			logger.Log.Errorf("Цепочка журнала аудита нарушена: seq=%d, %s", chainBreak.Seq, chainBreak.Reason)
+			os.Exit(1)
+		}
+		logger.Log.Infoln("Цепочка журнала аудита цела.")
+		return
+	}
+
+	auditService.StartCheckpoints(config.GetAuditParams().CheckpointInterval)
+	retentionParams := config.GetRetentionParams()
+	userService.StartPurge(retentionParams.PurgeInterval, retentionParams.UserRetention)
+
 	e := echo.New()
-	routing.SetupUserRoute(e, userService)
+	routing.SetupErrorHandler(e)
+	routing.SetupValidator(e)
+	routing.SetupDPoPMiddleware(e, dpop.NewVerifier(dpop.NewMemoryReplayStore(), config.GetDPoPParams().ProofWindow))
+	limitStore := ratelimit.NewMemoryStore()
+	rateLimits := config.GetRateLimitParams()
+	cookieParams := config.GetCookieParams(jwtModel.RefreshDuration)
+	routing.SetupUserRoute(e, userService, limitStore, rateLimits, cookieParams, config.GetTokenTransportParams(), config.GetLegacyRoutesParams(), authenticator)
+	routing.SetupLoginRoute(e, userService, limitStore, rateLimits, cookieParams)
+	routing.SetupMeRoute(e, userService, auditService, limitStore, rateLimits, jwtManager)
+	if config.GetMetricsParams().Enabled {
+		routing.SetupMetricsRoute(e, metrics, authenticator)
+	}
+	routing.SetupAdminRoute(e, userService, auditService, apiKeyService, authenticator)
+	routing.SetupOAuthRoute(e, oauthService, jwtManager, cookieParams)
+	routing.SetupOIDCRoute(e, oidcService, authenticator, cookieParams)
+	routing.SetupSSORoute(e, ssoService, authenticator, cookieParams)
+	routing.SetupTokenRoute(e, tokenService, authenticator)
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
-	e.Logger.Fatal(e.Start(config.GetServerParams().ServerHost))
+	serverHost := config.GetServerParams().ServerHost
+	tlsModel := config.GetTLSParams()
+	if tlsModel.CertFile == "" {
+		e.Logger.Fatal(e.Start(serverHost))
+	}
+
+	tlsConfig, err := mtls.NewServerTLSConfig(tlsModel.CertFile, tlsModel.KeyFile, tlsModel.ClientCAFile, tlsModel.RequireClientCert)
+	if err != nil {
+		logger.Log.Fatal("Ошибка загрузки TLS сертификатов:", err)
+	}
+	e.Logger.Fatal(e.StartServer(&http.Server{Addr: serverHost, TLSConfig: tlsConfig}))
 }
@@ -0,0 +1,212 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type AdminHandler struct {
+	service service.UserServiceInterface
+}
+
+func NewAdminHandler(service service.UserServiceInterface) *AdminHandler {
+	return &AdminHandler{service: service}
+}
+
+type AdminHandlerInterface interface {
+	UnlockUser(c echo.Context) error
+	GetUser(c echo.Context) error
+	UpdateUser(c echo.Context) error
+	DisableUser(c echo.Context) error
+	EnableUser(c echo.Context) error
+	LogoutUser(c echo.Context) error
+	DeleteUser(c echo.Context) error
+}
+
+// UnlockUser godoc
+// @Summary Unlock User
+// @Description Снятие блокировки со всех refresh сессий пользователя после неудачных попыток обновления токенов и сброс счётчиков. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Success 204 "User unlocked"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /admin/users/{guid}/unlock [post]
+func (h *AdminHandler) UnlockUser(c echo.Context) error {
+	var req request.UserGUIDRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	admin := claimsFromContext(c)
+	if err := h.service.Unlock(req.GUID, admin.Subject, clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUser godoc
+// @Summary Get User
+// @Description Получение пользователя по GUID. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Success 200 {object} response.UserResponse "User"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /admin/users/{guid} [get]
+func (h *AdminHandler) GetUser(c echo.Context) error {
+	var req request.UserGUIDRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	user, err := h.service.Get(req.GUID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.NewUserResponse(*user))
+}
+
+// UpdateUser godoc
+// @Summary Update User
+// @Description Смена email пользователя. Новый адрес считается неподтверждённым. Доступно только администраторам
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Param user body request.UpdateUserRequest true "New email"
+// @Success 200 {object} response.UserResponse "Updated user"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID or email"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Failure 409 {object} response.ProblemResponse "Email already registered"
+// @Router /admin/users/{guid} [patch]
+func (h *AdminHandler) UpdateUser(c echo.Context) error {
+	var req request.UpdateUserRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	user, err := h.service.ChangeEmail(req.GUID, req.Email, claimsFromContext(c).Subject, clientInfo(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.NewUserResponse(*user))
+}
+
+// DisableUser godoc
+// @Summary Disable User
+// @Description Отключение учётной записи: все refresh сессии отзываются, вход и обновление токенов запрещены до включения. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Success 204 "User disabled"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden or own account"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /admin/users/{guid}/disable [post]
+func (h *AdminHandler) DisableUser(c echo.Context) error {
+	return h.setStatus(c, domain.UserStatusDisabled)
+}
+
+// EnableUser godoc
+// @Summary Enable User
+// @Description Включение отключённой учётной записи. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Success 204 "User enabled"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /admin/users/{guid}/enable [post]
+func (h *AdminHandler) EnableUser(c echo.Context) error {
+	return h.setStatus(c, domain.UserStatusActive)
+}
+
+func (h *AdminHandler) setStatus(c echo.Context, status string) error {
+	var req request.UserGUIDRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.service.SetStatus(req.GUID, status, claimsFromContext(c).Subject, clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutUser godoc
+// @Summary Force Logout
+// @Description Принудительный выход: все refresh сессии пользователя отзываются, выданный access token действует до истечения срока. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Success 204 "Refresh token revoked"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /admin/users/{guid}/logout [post]
+func (h *AdminHandler) LogoutUser(c echo.Context) error {
+	var req request.UserGUIDRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.service.ForceLogout(req.GUID, claimsFromContext(c).Subject, clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteUser godoc
+// @Summary Delete User
+// @Description Мягкое удаление: пользователь получает статус deleted и исчезает из выдачи, окончательно он удаляется вместе с personal access tokens и привязками SSO через USER_RETENTION_DAYS. Записи аудита сохраняются. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param guid path string true "User GUID"
+// @Success 204 "User deleted"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /admin/users/{guid} [delete]
+func (h *AdminHandler) DeleteUser(c echo.Context) error {
+	var req request.UserGUIDRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.service.Delete(req.GUID, claimsFromContext(c).Subject, clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
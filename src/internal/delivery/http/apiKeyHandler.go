@@ -0,0 +1,85 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type APIKeyHandler struct {
+	service service.APIKeyServiceInterface
+}
+
+func NewAPIKeyHandler(service service.APIKeyServiceInterface) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+type APIKeyHandlerInterface interface {
+	CreateKey(c echo.Context) error
+	ListKeys(c echo.Context) error
+	RevokeKey(c echo.Context) error
+}
+
+// CreateKey godoc
+// @Summary Create API Key
+// @Description Выпуск API ключа для интеграции. Ключ вида `jtt_key_<prefix>_<secret>` показывается один раз и передаётся в заголовке `X-API-Key`.
+// @Description Можно ограничить ключ списком IP и CIDR. Доступно только администраторам с access token, не с PAT или API ключом
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param key body request.APIKeyRequest true "API key"
+// @Success 201 {object} response.APIKeyResponse "Created key"
+// @Failure 400 {object} response.ProblemResponse "Invalid request"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Router /admin/api-keys [post]
+func (h *APIKeyHandler) CreateKey(c echo.Context) error {
+	var req request.APIKeyRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	key, err := h.service.Create(claimsFromContext(c), req, clientInfo(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, key)
+}
+
+// ListKeys godoc
+// @Summary List API Keys
+// @Description Все API ключи со статистикой использования. Секреты не возвращаются. Доступно только администраторам с access token
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} domain.APIKey "Keys"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Router /admin/api-keys [get]
+func (h *APIKeyHandler) ListKeys(c echo.Context) error {
+	keys, err := h.service.GetAll(claimsFromContext(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeKey godoc
+// @Summary Revoke API Key
+// @Description Отзыв API ключа, действует немедленно. Доступно только администраторам с access token
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "Key ID"
+// @Success 204 "Key revoked"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "Key not found"
+// @Router /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeKey(c echo.Context) error {
+	if err := h.service.Revoke(claimsFromContext(c), c.Param("id"), clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+type AuditHandler struct {
+	service service.AuditServiceInterface
+}
+
+func NewAuditHandler(service service.AuditServiceInterface) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+type AuditHandlerInterface interface {
+	GetEvents(c echo.Context) error
+}
+
+// GetEvents godoc
+// @Summary Get Audit Events
+// @Description Журнал событий аутентификации с фильтрацией и курсорной пагинацией. Доступно только администраторам
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param user_guid query string false "User GUID"
+// @Param event_type query string false "Event type" Enums(sign_in, sign_up, refresh, ip_warning, logout)
+// @Param from query string false "From (RFC3339)"
+// @Param to query string false "To (RFC3339)"
+// @Param cursor query string false "Cursor from previous page"
+// @Param limit query int false "Number of events per page" default(50) minimum(1) maximum(500)
+// @Success 200 {object} response.AuditEventsResponse "Successful response with audit events"
+// @Failure 400 {object} response.ProblemResponse "Invalid filter"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 500 {object} response.ProblemResponse "Internal server error"
+// @Router /admin/audit-events [get]
+func (h *AuditHandler) GetEvents(c echo.Context) error {
+	req := request.AuditEventsRequest{Limit: 50}
+	if err := bindQuery(c, &req); err != nil {
+		return err
+	}
+
+	// Формат полей уже проверен валидатором.
+	filter := repository.AuditFilter{EventType: req.EventType}
+	if req.UserGUID != "" {
+		guid := uuid.MustParse(req.UserGUID)
+		filter.UserGUID = &guid
+	}
+	if req.From != "" {
+		from, _ := time.Parse(time.RFC3339, req.From)
+		filter.From = &from
+	}
+	if req.To != "" {
+		to, _ := time.Parse(time.RFC3339, req.To)
+		filter.To = &to
+	}
+
+	events, nextCursor, err := h.service.Find(filter, req.Cursor, req.Limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, response.AuditEventsResponse{Events: events, NextCursor: nextCursor})
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"JwtTestTask/src/pkg/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+const (
+	refreshCookieName = "refresh_token"
+	// refresh cookie отправляется только на эндпоинт обновления той версии API, где она выдана.
+	refreshCookiePath       = "/api/v1/tokens"
+	legacyRefreshCookiePath = "/refresh"
+	csrfCookieName          = "csrf_token"
+	HeaderCSRFToken         = "X-CSRF-Token"
+
+	DeliveryBody   = "body"
+	DeliveryCookie = "cookie"
+)
+
+// setTokenCookies кладёт refresh token в HttpOnly cookie, доступную только эндпоинту обновления path, и выставляет
+// CSRF токен для double-submit: его cookie читается JavaScript и отправляется обратно в X-CSRF-Token.
+func setTokenCookies(c echo.Context, params config.CookieParams, path string, refreshToken string) error {
+	csrfBytes := make([]byte, 32)
+	if _, err := rand.Read(csrfBytes); err != nil {
+		return err
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken,
+		Path:     path,
+		Domain:   params.Domain,
+		MaxAge:   int(params.MaxAge.Seconds()),
+		Secure:   params.Secure,
+		HttpOnly: true,
+		SameSite: params.SameSite,
+	})
+	c.SetCookie(&http.Cookie{
+		Name:     csrfCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(csrfBytes),
+		Path:     "/",
+		Domain:   params.Domain,
+		MaxAge:   int(params.MaxAge.Seconds()),
+		Secure:   params.Secure,
+		SameSite: params.SameSite,
+	})
+	return nil
+}
+
+func clearTokenCookies(c echo.Context, params config.CookieParams, path string) {
+	c.SetCookie(&http.Cookie{Name: refreshCookieName, Path: path, Domain: params.Domain, MaxAge: -1, Expires: time.Unix(0, 0), Secure: params.Secure, HttpOnly: true, SameSite: params.SameSite})
+	c.SetCookie(&http.Cookie{Name: csrfCookieName, Path: "/", Domain: params.Domain, MaxAge: -1, Expires: time.Unix(0, 0), Secure: params.Secure, SameSite: params.SameSite})
+}
+
+func refreshTokenFromCookie(c echo.Context) string {
+	cookie, err := c.Cookie(refreshCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func validCSRF(c echo.Context) bool {
+	cookie, err := c.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := c.Request().Header.Get(HeaderCSRFToken)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"JwtTestTask/src/pkg/config"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+)
+
+// DeprecationMiddleware помечает ответы устаревшего маршрута заголовками Deprecation (RFC 9745)
+// и Sunset (RFC 8594), а Link указывает на замену в /api/v1.
+func DeprecationMiddleware(params config.LegacyRoutesParams, successor string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set(HeaderDeprecation, fmt.Sprintf("@%d", params.DeprecatedAt.Unix()))
+			if !params.Sunset.IsZero() {
+				header.Set(HeaderSunset, params.Sunset.UTC().Format(http.TimeFormat))
+			}
+			header.Set(HeaderLink, fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/dpop"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"strings"
+)
+
+const (
+	HeaderDPoP       = "DPoP"
+	dpopContextKey   = "dpop_jkt"
+	dpopAuthScheme   = "DPoP "
+	bearerAuthScheme = "Bearer "
+)
+
+// DPoPMiddleware проверяет заголовок DPoP, если он есть, и сохраняет thumbprint ключа в контексте.
+// Дальше его используют clientInfo при выдаче токенов и AuthMiddleware для привязанных токенов.
+// При схеме Authorization: DPoP proof должен содержать хеш access token (ath).
+func DPoPMiddleware(proofs dpop.VerifierInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			values := c.Request().Header.Values(HeaderDPoP)
+			if len(values) == 0 {
+				return next(c)
+			}
+			if len(values) > 1 {
+				return service.WithDetail(service.ErrInvalidRequest, "multiple dpop proofs")
+			}
+
+			accessToken, _ := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), dpopAuthScheme)
+			requestURL := c.Scheme() + "://" + c.Request().Host + c.Request().URL.Path
+			jkt, err := proofs.Verify(values[0], c.Request().Method, requestURL, accessToken)
+			if err != nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `DPoP error="invalid_dpop_proof"`)
+				return fmt.Errorf("%w: %s", ErrInvalidDPoPProof, err.Error())
+			}
+
+			c.Set(dpopContextKey, jkt)
+			return next(c)
+		}
+	}
+}
+
+func dpopThumbprint(c echo.Context) string {
+	jkt, _ := c.Get(dpopContextKey).(string)
+	return jkt
+}
+
+// accessTokenFromHeader принимает access token в схемах Bearer и DPoP.
+func accessTokenFromHeader(c echo.Context) (string, bool) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if token, found := strings.CutPrefix(header, dpopAuthScheme); found {
+		return token, true
+	}
+	token, _ := strings.CutPrefix(header, bearerAuthScheme)
+	return token, false
+}
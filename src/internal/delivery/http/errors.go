@@ -0,0 +1,135 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/logger"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+const (
+	MIMEProblemJSON = "application/problem+json"
+
+	// problemTypeBase версионирует каталог кодов: коды v1 не меняют смысл и статус,
+	// несовместимые изменения получают новую версию.
+	problemTypeBase = "/problems/v1/"
+)
+
+// Ошибки транспортного уровня, которые не возникают в сервисах.
+var (
+	ErrRateLimited      = errors.New("too many requests")
+	ErrCSRFMismatch     = errors.New("csrf token mismatch")
+	ErrInvalidDPoPProof = errors.New("invalid dpop proof")
+)
+
+type problemKind struct {
+	err    error
+	status int
+	code   string
+}
+
+// problemKinds проверяются по порядку через errors.Is.
+var problemKinds = []problemKind{
+	{service.ErrInvalidRequest, http.StatusBadRequest, "invalid_request"},
+	{service.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{service.ErrInvalidToken, http.StatusUnauthorized, "invalid_token"},
+	{service.ErrTokenExpired, http.StatusUnauthorized, "token_expired"},
+	{service.ErrIPMismatch, http.StatusUnauthorized, "ip_mismatch"},
+	{service.ErrTokenBinding, http.StatusUnauthorized, "token_binding_mismatch"},
+	{ErrInvalidDPoPProof, http.StatusUnauthorized, "invalid_dpop_proof"},
+	{service.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{ErrCSRFMismatch, http.StatusForbidden, "csrf_mismatch"},
+	{service.ErrAccountDisabled, http.StatusForbidden, "account_disabled"},
+	{service.ErrAccountPending, http.StatusForbidden, "account_pending"},
+	{service.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{service.ErrNotFound, http.StatusNotFound, "not_found"},
+	{service.ErrDuplicateEmail, http.StatusConflict, "duplicate_email"},
+	{service.ErrAccountLocked, http.StatusLocked, "account_locked"},
+	{ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+}
+
+// ErrorHandler — центральный обработчик ошибок Echo. Отвечает application/problem+json (RFC 7807)
+// со стабильным кодом в поле code. Неизвестные ошибки логируются и скрываются за 500.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	problem := newProblem(err)
+	problem.Instance = c.Request().URL.Path
+	if problem.Status == http.StatusInternalServerError {
+		logger.Log.Errorf("Ошибка обработки запроса %s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		err = c.JSON(problem.Status, problem)
+	}
+	if err != nil {
+		logger.Log.Errorln("Ошибка отправки ответа:", err)
+	}
+}
+
+func newProblem(err error) response.ProblemResponse {
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			problem := response.ProblemResponse{
+				Type:   problemTypeBase + kind.code,
+				Title:  kind.err.Error(),
+				Status: kind.status,
+				Detail: err.Error(),
+				Code:   kind.code,
+			}
+			var validationError *ValidationError
+			if errors.As(err, &validationError) {
+				problem.Errors = validationError.Fields
+			}
+			return problem
+		}
+	}
+
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		code := strings.ReplaceAll(strings.ToLower(http.StatusText(httpError.Code)), " ", "_")
+		return response.ProblemResponse{
+			Type:   problemTypeBase + code,
+			Title:  http.StatusText(httpError.Code),
+			Status: httpError.Code,
+			Detail: fmt.Sprint(httpError.Message),
+			Code:   code,
+		}
+	}
+
+	return response.ProblemResponse{
+		Type:   problemTypeBase + "internal_error",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Code:   "internal_error",
+	}
+}
+
+// invalidRequest оборачивает ошибку привязки запроса, для echo.HTTPError берётся только сообщение.
+func invalidRequest(err error) error {
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		return service.WithDetail(service.ErrInvalidRequest, fmt.Sprint(httpError.Message))
+	}
+	return service.WithDetail(service.ErrInvalidRequest, err.Error())
+}
+
+// invalidToken сохраняет типовые ошибки аутентификаторов, остальные (ошибки разбора JWT)
+// считает недействительным токеном.
+func invalidToken(err error) error {
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			return err
+		}
+	}
+	return service.WithDetail(service.ErrInvalidToken, err.Error())
+}
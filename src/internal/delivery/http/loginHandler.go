@@ -0,0 +1,90 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/config"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// LoginHandler — вход в браузере для эндпоинтов сервера авторизации (/authorize, /device).
+// После входа браузер получает cookie сессии и возвращается на return_to.
+type LoginHandler struct {
+	service service.UserServiceInterface
+	cookies config.CookieParams
+}
+
+func NewLoginHandler(service service.UserServiceInterface, cookies config.CookieParams) *LoginHandler {
+	return &LoginHandler{service: service, cookies: cookies}
+}
+
+type LoginHandlerInterface interface {
+	LoginPage(c echo.Context) error
+	Login(c echo.Context) error
+}
+
+// LoginPage godoc
+// @Summary Login Page
+// @Description HTML форма входа. На неё перенаправляют /authorize и /device, если у браузера нет сессии
+// @Tags oauth
+// @Produce html
+// @Param return_to query string false "Local path to return to after sign in"
+// @Success 200 "Login form"
+// @Router /login [get]
+func (h *LoginHandler) LoginPage(c echo.Context) error {
+	return h.render(c, http.StatusOK, request.LoginRequest{ReturnTo: c.QueryParam("return_to")}, "")
+}
+
+// Login godoc
+// @Summary Login
+// @Description Вход из HTML формы: выставляет HttpOnly cookie session с access token и перенаправляет на return_to.
+// @Description Refresh token не выдаётся, сессии приложений пользователя не затрагиваются
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param guid formData string true "User GUID"
+// @Param return_to formData string false "Local path to return to after sign in"
+// @Param csrf_token formData string true "Value of the csrf_token cookie"
+// @Success 303 "Redirect to return_to"
+// @Failure 400 "Invalid form"
+// @Failure 401 "Sign in failed"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Router /login [post]
+func (h *LoginHandler) Login(c echo.Context) error {
+	var req request.LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return h.render(c, http.StatusBadRequest, req, "Invalid form.")
+	}
+	if !validFormCSRF(c) {
+		return h.render(c, http.StatusBadRequest, req, "The form has expired, please try again.")
+	}
+	if err := validateRequest(c, &req); err != nil {
+		return h.render(c, http.StatusBadRequest, req, "Enter a valid user GUID.")
+	}
+
+	accessToken, err := h.service.SignInSession(req.GUID, clientInfo(c))
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrAccountDisabled),
+		errors.Is(err, service.ErrAccountPending), errors.Is(err, service.ErrAccountLocked):
+		return h.render(c, http.StatusUnauthorized, req, "Sign in failed: "+err.Error()+".")
+	case err != nil:
+		return err
+	}
+
+	setSessionCookie(c, h.cookies, accessToken)
+	if returnTo := localPath(req.ReturnTo); returnTo != "" {
+		return c.Redirect(http.StatusSeeOther, returnTo)
+	}
+	return renderPage(c, http.StatusOK, "message", messagePageData{Title: "Signed in", Text: "You are signed in. You can close this page."})
+}
+
+func (h *LoginHandler) render(c echo.Context, status int, req request.LoginRequest, message string) error {
+	csrfToken, err := formCSRFToken(c, h.cookies)
+	if err != nil {
+		return err
+	}
+	data := loginPageData{GUID: req.GUID, ReturnTo: localPath(req.ReturnTo), CSRFToken: csrfToken, Error: message}
+	return renderPage(c, status, "login", data)
+}
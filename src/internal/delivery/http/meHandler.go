@@ -0,0 +1,186 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/internal/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// MeHandler — эндпоинты пользователя для своей учётной записи. Пользователь определяется
+// по subject access token, GUID в запросе не передаётся.
+type MeHandler struct {
+	users service.UserServiceInterface
+	audit service.AuditServiceInterface
+}
+
+func NewMeHandler(users service.UserServiceInterface, audit service.AuditServiceInterface) *MeHandler {
+	return &MeHandler{users: users, audit: audit}
+}
+
+type MeHandlerInterface interface {
+	GetProfile(c echo.Context) error
+	ChangeEmail(c echo.Context) error
+	ConfirmEmail(c echo.Context) error
+	GetActivity(c echo.Context) error
+	DeleteAccount(c echo.Context) error
+}
+
+// GetProfile godoc
+// @Summary Get Profile
+// @Description Профиль текущего пользователя
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.UserResponse "User"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /api/v1/me [get]
+func (h *MeHandler) GetProfile(c echo.Context) error {
+	user, err := h.users.Get(claimsFromContext(c).Subject)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.NewUserResponse(*user))
+}
+
+// ChangeEmail godoc
+// @Summary Change Email
+// @Description Запрос на смену email: на новый адрес отправляется код подтверждения, на старый — уведомление.
+// @Description Email меняется только после POST /api/v1/me/email/confirm, код действует 24 часа
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param email body request.EmailChangeRequest true "New email"
+// @Success 202 {object} response.EmailChangeResponse "Verification code sent"
+// @Failure 400 {object} response.ProblemResponse "Invalid email"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Token was not issued by sign in"
+// @Failure 409 {object} response.ProblemResponse "Email already registered"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Router /api/v1/me/email [post]
+func (h *MeHandler) ChangeEmail(c echo.Context) error {
+	guid, err := ownerSubject(c)
+	if err != nil {
+		return err
+	}
+	var req request.EmailChangeRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	expiresAt, err := h.users.RequestEmailChange(guid, req.Email, clientInfo(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, response.EmailChangeResponse{PendingEmail: req.Email, ExpiresAt: expiresAt})
+}
+
+// ConfirmEmail godoc
+// @Summary Confirm Email Change
+// @Description Подтверждение нового email кодом из письма. Новый адрес считается подтверждённым
+// @Tags me
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code body request.EmailConfirmRequest true "Verification code"
+// @Success 200 {object} response.UserResponse "Updated user"
+// @Failure 400 {object} response.ProblemResponse "Invalid or expired code"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Token was not issued by sign in"
+// @Failure 409 {object} response.ProblemResponse "Email already registered"
+// @Router /api/v1/me/email/confirm [post]
+func (h *MeHandler) ConfirmEmail(c echo.Context) error {
+	guid, err := ownerSubject(c)
+	if err != nil {
+		return err
+	}
+	var req request.EmailConfirmRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	user, err := h.users.ConfirmEmailChange(guid, req.Code, clientInfo(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.NewUserResponse(*user))
+}
+
+// GetActivity godoc
+// @Summary Get Security Activity
+// @Description События безопасности текущего пользователя из журнала аудита (входы, обновления токенов, смена IP, блокировки и т.д.), новые первыми
+// @Tags me
+// @Produce json
+// @Security BearerAuth
+// @Param cursor query string false "Cursor from previous page"
+// @Param limit query int false "Number of events per page" default(20) minimum(1) maximum(100)
+// @Success 200 {object} response.ActivityResponse "Security events"
+// @Failure 400 {object} response.ProblemResponse "Invalid cursor or limit"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Router /api/v1/me/activity [get]
+func (h *MeHandler) GetActivity(c echo.Context) error {
+	req := request.ActivityRequest{Limit: 20}
+	if err := bindQuery(c, &req); err != nil {
+		return err
+	}
+	guid, err := uuid.Parse(claimsFromContext(c).Subject)
+	if err != nil {
+		return service.ErrUserNotFound
+	}
+
+	events, nextCursor, err := h.audit.Find(repository.AuditFilter{UserGUID: &guid}, req.Cursor, req.Limit)
+	if err != nil {
+		return err
+	}
+
+	activity := make([]response.ActivityEvent, 0, len(events))
+	for _, e := range events {
+		activity = append(activity, response.ActivityEvent{
+			EventType: e.EventType,
+			Result:    e.Result,
+			Reason:    e.Reason,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, response.ActivityResponse{Events: activity, NextCursor: nextCursor})
+}
+
+// DeleteAccount godoc
+// @Summary Delete Account
+// @Description Удаление собственной учётной записи. Удаление мягкое, как и DELETE /admin/users/{guid}: войти больше нельзя,
+// @Description данные удаляются окончательно через USER_RETENTION_DAYS
+// @Tags me
+// @Security BearerAuth
+// @Success 204 "Account deleted"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Token was not issued by sign in"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /api/v1/me [delete]
+func (h *MeHandler) DeleteAccount(c echo.Context) error {
+	guid, err := ownerSubject(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.users.Delete(guid, guid, clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ownerSubject разрешает менять учётную запись только токеном, выданным при входе самого пользователя.
+// Токены OAuth клиентов и полученные обменом токенов (у них есть client_id) могут только читать.
+func ownerSubject(c echo.Context) (string, error) {
+	claims := claimsFromContext(c)
+	if claims.ClientID != "" || claims.Act != nil {
+		return "", service.WithDetail(service.ErrForbidden, "account changes require a token issued by sign in")
+	}
+	return claims.Subject, nil
+}
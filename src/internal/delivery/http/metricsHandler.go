@@ -0,0 +1,30 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/subscriber"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type MetricsHandler struct {
+	metrics *subscriber.Metrics
+}
+
+func NewMetricsHandler(metrics *subscriber.Metrics) *MetricsHandler {
+	return &MetricsHandler{metrics: metrics}
+}
+
+// GetMetrics godoc
+// @Summary Event Metrics
+// @Description Счётчики доменных событий с момента запуска сервиса. Доступно только администраторам, отключается METRICS_ENABLED=false
+// @Tags metrics
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Success 200 {object} map[string]int64 "Event counters"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Router /metrics [get]
+func (h *MetricsHandler) GetMetrics(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.metrics.Snapshot())
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/mtls"
+	"crypto/x509"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	claimsContextKey = "claims"
+	HeaderAPIKey     = "X-API-Key"
+)
+
+// APIKeyParserInterface реализуют аутентификаторы, принимающие API ключи. Ключ проверяется
+// вместе с адресом клиента из-за списка разрешённых IP.
+type APIKeyParserInterface interface {
+	ParseAPIKey(key, ip string) (*auth.CustomClaims, error)
+}
+
+func AuthMiddleware(parser auth.TokenParserInterface) echo.MiddlewareFunc {
+	keyParser, acceptsKeys := parser.(APIKeyParserInterface)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if key := c.Request().Header.Get(HeaderAPIKey); key != "" && acceptsKeys {
+				claims, err := keyParser.ParseAPIKey(key, remoteHost(c))
+				if err != nil {
+					return invalidToken(err)
+				}
+				c.Set(claimsContextKey, claims)
+				return next(c)
+			}
+
+			token, dpopScheme := accessTokenFromHeader(c)
+			if token == "" {
+				return service.WithDetail(service.ErrUnauthorized, "missing bearer token")
+			}
+
+			claims, err := parser.Parse(token)
+			if err != nil {
+				return invalidToken(err)
+			}
+
+			// Токен, привязанный к сертификату, принимается только в соединении с тем же сертификатом.
+			if claims.Cnf != nil && claims.Cnf.X5T != "" {
+				if cert := clientCertificate(c); cert == nil || mtls.Thumbprint(cert) != claims.Cnf.X5T {
+					return service.WithDetail(service.ErrTokenBinding, "token is bound to a different client certificate")
+				}
+			}
+
+			// Привязанный к ключу токен принимается только по схеме DPoP с proof того же ключа,
+			// непривязанный — только по схеме Bearer.
+			if claims.Cnf != nil && claims.Cnf.JKT != "" {
+				if !dpopScheme || dpopThumbprint(c) != claims.Cnf.JKT {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `DPoP error="invalid_token"`)
+					return service.WithDetail(service.ErrTokenBinding, "dpop proof with the bound key is required")
+				}
+			} else if dpopScheme {
+				return service.WithDetail(service.ErrInvalidToken, "token is not bound to a dpop key")
+			}
+
+			c.Set(claimsContextKey, claims)
+			return next(c)
+		}
+	}
+}
+
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims := claimsFromContext(c)
+			if claims == nil || claims.Role != role {
+				return service.ErrForbidden
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireUserToken пропускает только токены, выданные самому пользователю (вход, PAT, API ключ).
+// Токены OAuth клиентов и полученные обменом (act) не дают доступа к администрированию,
+// выпуску PAT и подтверждению доступа для других клиентов.
+func RequireUserToken() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims := claimsFromContext(c)
+			if claims == nil || claims.Act != nil {
+				return service.WithDetail(service.ErrForbidden, "delegated tokens are not accepted here")
+			}
+			switch claims.ClientID {
+			case "", service.PersonalTokenClientID, service.APIKeyClientID:
+				return next(c)
+			default:
+				return service.WithDetail(service.ErrForbidden, "oauth client tokens are not accepted here")
+			}
+		}
+	}
+}
+
+func claimsFromContext(c echo.Context) *auth.CustomClaims {
+	claims, _ := c.Get(claimsContextKey).(*auth.CustomClaims)
+	return claims
+}
+
+// clientCertificate возвращает клиентский сертификат соединения, только если он прошёл проверку
+// по TLS_CLIENT_CA_FILE.
+func clientCertificate(c echo.Context) *x509.Certificate {
+	state := c.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
@@ -0,0 +1,288 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/config"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+)
+
+type OAuthHandler struct {
+	service service.OAuthServiceInterface
+	cookies config.CookieParams
+}
+
+func NewOAuthHandler(service service.OAuthServiceInterface, cookies config.CookieParams) *OAuthHandler {
+	return &OAuthHandler{service: service, cookies: cookies}
+}
+
+type OAuthHandlerInterface interface {
+	Authorize(c echo.Context) error
+	Token(c echo.Context) error
+	RegisterClient(c echo.Context) error
+	DeviceAuthorization(c echo.Context) error
+	VerifyDevice(c echo.Context) error
+	DevicePage(c echo.Context) error
+	ConfirmDevice(c echo.Context) error
+}
+
+// Authorize godoc
+// @Summary OAuth 2.0 Authorization Endpoint
+// @Description Выдача authorization code для authorization code flow с обязательным PKCE (S256).
+// @Description Браузер аутентифицируется cookie сессии из /login, без неё перенаправляется на /login и возвращается сюда после входа.
+// @Description Access token в заголовке Authorization тоже принимается. После проверки выполняется redirect на redirect_uri с code и state
+// @Tags oauth
+// @Security BearerAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space separated scopes"
+// @Param state query string false "Opaque client state"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "PKCE method" Enums(S256)
+// @Success 302 "Redirect to redirect_uri with code or error, or to /login without a session"
+// @Failure 400 {object} response.OAuthErrorResponse "Invalid client or redirect_uri"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Router /authorize [get]
+func (h *OAuthHandler) Authorize(c echo.Context) error {
+	var req request.AuthorizeRequest
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.OAuthErrorResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+	}
+
+	redirectURL, err := h.service.Authorize(req, claimsFromContext(c).Subject)
+	if err != nil {
+		return oauthError(c, err)
+	}
+	return c.Redirect(http.StatusFound, redirectURL)
+}
+
+// Token godoc
+// @Summary OAuth 2.0 Token Endpoint
+// @Description authorization_code: обмен authorization code и code_verifier на пару access & refresh токенов.
+// @Description client_credentials: access token для сервисов без пользователя, subject токена — client_id.
+// @Description device_code: опрос устройством, пока пользователь не подтвердит user_code (authorization_pending, slow_down).
+// @Description token-exchange: обмен access token пользователя на более узкий токен для другого сервиса с claim act (RFC 8693).
+// @Description Конфиденциальные клиенты аутентифицируются через HTTP Basic или client_id & client_secret в форме
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "Grant type" Enums(authorization_code, client_credentials, urn:ietf:params:oauth:grant-type:device_code, urn:ietf:params:oauth:grant-type:token-exchange)
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in /authorize"
+// @Param client_id formData string false "Client ID (if not sent via HTTP Basic)"
+// @Param client_secret formData string false "Client secret (if not sent via HTTP Basic)"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param scope formData string false "Requested scopes for client_credentials"
+// @Param device_code formData string false "Device code for device flow polling"
+// @Param subject_token formData string false "Token exchange: access token of the subject, or user GUID for impersonation"
+// @Param subject_token_type formData string false "Token exchange: urn:ietf:params:oauth:token-type:access_token or urn:jwttesttask:params:oauth:token-type:user_guid"
+// @Param actor_token formData string false "Token exchange: access token of the impersonating admin"
+// @Param actor_token_type formData string false "Token exchange: urn:ietf:params:oauth:token-type:access_token"
+// @Param audience formData string false "Token exchange: target service"
+// @Param requested_token_type formData string false "Token exchange: requested token type"
+// @Param DPoP header string false "DPoP proof JWT: binds issued tokens to the client key (RFC 9449)"
+// @Success 200 {object} response.TokenResponse "Issued tokens"
+// @Failure 400 {object} response.OAuthErrorResponse "OAuth error"
+// @Failure 401 {object} response.OAuthErrorResponse "Invalid client"
+// @Router /token [post]
+func (h *OAuthHandler) Token(c echo.Context) error {
+	var req request.TokenRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.OAuthErrorResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+	}
+
+	bindClientBasicAuth(c, &req.ClientID, &req.ClientSecret)
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	tokens, err := h.service.Token(req, clientInfo(c))
+	if err != nil {
+		return oauthError(c, err)
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RegisterClient godoc
+// @Summary Register OAuth Client
+// @Description Регистрация OAuth клиента. Публичные клиенты (SPA, мобильные приложения) используют authorization code + PKCE,
+// @Description конфиденциальные получают client_secret, который показывается один раз. Доступно только администраторам
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param client body request.OAuthClientRequest true "Client"
+// @Success 201 {object} response.OAuthClientResponse "Registered client"
+// @Failure 400 {object} response.ProblemResponse "Invalid client"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Router /admin/oauth/clients [post]
+func (h *OAuthHandler) RegisterClient(c echo.Context) error {
+	var req request.OAuthClientRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	client, err := h.service.RegisterClient(req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, client)
+}
+
+// DeviceAuthorization godoc
+// @Summary OAuth 2.0 Device Authorization Endpoint
+// @Description Выдача device_code и user_code для устройств без браузера (RFC 8628).
+// @Description Пользователь вводит user_code на verification_uri, устройство опрашивает /token
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string false "Client ID (if not sent via HTTP Basic)"
+// @Param client_secret formData string false "Client secret for confidential clients"
+// @Param scope formData string false "Requested scopes"
+// @Success 200 {object} response.DeviceAuthorizationResponse "Device and user codes"
+// @Failure 400 {object} response.OAuthErrorResponse "OAuth error"
+// @Failure 401 {object} response.OAuthErrorResponse "Invalid client"
+// @Router /device_authorization [post]
+func (h *OAuthHandler) DeviceAuthorization(c echo.Context) error {
+	var req request.DeviceAuthorizationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.OAuthErrorResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+	}
+	bindClientBasicAuth(c, &req.ClientID, &req.ClientSecret)
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	codes, err := h.service.DeviceAuthorization(req, clientInfo(c))
+	if err != nil {
+		return oauthError(c, err)
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
+// VerifyDevice godoc
+// @Summary Approve Device
+// @Description Подтверждение или отклонение user_code устройства авторизованным пользователем через API. Браузеры используют страницу GET /device
+// @Tags oauth
+// @Accept json
+// @Security BearerAuth
+// @Param verification body request.DeviceVerificationRequest true "User code and decision"
+// @Success 204 "Decision saved"
+// @Failure 400 {object} response.ProblemResponse "Invalid or expired user code"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Router /device/verify [post]
+func (h *OAuthHandler) VerifyDevice(c echo.Context) error {
+	var req request.DeviceVerificationRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.service.VerifyDevice(req, claimsFromContext(c).Subject); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DevicePage godoc
+// @Summary Device Verification Page
+// @Description HTML страница verification_uri: пользователь вводит user_code и подтверждает или отклоняет устройство.
+// @Description Без cookie сессии браузер перенаправляется на /login
+// @Tags oauth
+// @Produce html
+// @Param user_code query string false "User code from verification_uri_complete"
+// @Success 200 "Verification form"
+// @Success 302 "Redirect to /login without a session"
+// @Router /device [get]
+func (h *OAuthHandler) DevicePage(c echo.Context) error {
+	return h.renderDevicePage(c, http.StatusOK, c.QueryParam("user_code"), "")
+}
+
+// ConfirmDevice godoc
+// @Summary Confirm Device
+// @Description Отправка формы страницы /device: сохраняет решение пользователя по user_code
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param user_code formData string true "User code"
+// @Param approve formData boolean true "Approve or deny"
+// @Param csrf_token formData string true "Value of the csrf_token cookie"
+// @Success 200 "Decision saved"
+// @Failure 400 "Invalid form"
+// @Failure 404 "Invalid or expired user code"
+// @Router /device [post]
+func (h *OAuthHandler) ConfirmDevice(c echo.Context) error {
+	var req request.DeviceVerificationRequest
+	if err := c.Bind(&req); err != nil {
+		return h.renderDevicePage(c, http.StatusBadRequest, req.UserCode, "Invalid form.")
+	}
+	if !validFormCSRF(c) {
+		return h.renderDevicePage(c, http.StatusBadRequest, req.UserCode, "The form has expired, please try again.")
+	}
+	if err := validateRequest(c, &req); err != nil {
+		return h.renderDevicePage(c, http.StatusBadRequest, req.UserCode, "Enter the code shown on your device.")
+	}
+
+	err := h.service.VerifyDevice(req, claimsFromContext(c).Subject)
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return h.renderDevicePage(c, http.StatusNotFound, req.UserCode, "The code is invalid or has expired.")
+	case err != nil:
+		return err
+	}
+
+	if req.Approve {
+		return renderPage(c, http.StatusOK, "message", messagePageData{Title: "Device approved", Text: "Your device is now signed in. You can close this page."})
+	}
+	return renderPage(c, http.StatusOK, "message", messagePageData{Title: "Device denied", Text: "The device was not signed in. You can close this page."})
+}
+
+func (h *OAuthHandler) renderDevicePage(c echo.Context, status int, userCode string, message string) error {
+	csrfToken, err := formCSRFToken(c, h.cookies)
+	if err != nil {
+		return err
+	}
+	return renderPage(c, status, "device", devicePageData{UserCode: userCode, CSRFToken: csrfToken, Error: message})
+}
+
+// bindClientBasicAuth поддерживает client_secret_basic: учётные данные клиента в HTTP Basic
+// приоритетнее параметров формы.
+func bindClientBasicAuth(c echo.Context, clientID, clientSecret *string) {
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		*clientID, _ = url.QueryUnescape(id)
+		*clientSecret, _ = url.QueryUnescape(secret)
+	}
+}
+
+func oauthError(c echo.Context, err error) error {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return c.JSON(http.StatusInternalServerError, response.OAuthErrorResponse{Error: "server_error"})
+	}
+
+	if oauthErr.RedirectURI != "" {
+		params := url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}}
+		if oauthErr.State != "" {
+			params.Set("state", oauthErr.State)
+		}
+		redirect, parseErr := url.Parse(oauthErr.RedirectURI)
+		if parseErr == nil {
+			query := redirect.Query()
+			for key := range params {
+				query.Set(key, params.Get(key))
+			}
+			redirect.RawQuery = query.Encode()
+			return c.Redirect(http.StatusFound, redirect.String())
+		}
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	return c.JSON(status, response.OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
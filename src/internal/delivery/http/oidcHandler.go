@@ -0,0 +1,96 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/config"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type OIDCHandler struct {
+	service service.OIDCServiceInterface
+	cookies config.CookieParams
+}
+
+func NewOIDCHandler(service service.OIDCServiceInterface, cookies config.CookieParams) *OIDCHandler {
+	return &OIDCHandler{service: service, cookies: cookies}
+}
+
+type OIDCHandlerInterface interface {
+	Discovery(c echo.Context) error
+	JWKS(c echo.Context) error
+	UserInfo(c echo.Context) error
+	EndSession(c echo.Context) error
+}
+
+// Discovery godoc
+// @Summary OpenID Provider Configuration
+// @Description Метаданные OpenID Connect провайдера (OpenID Connect Discovery 1.0)
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} response.DiscoveryResponse "Provider metadata"
+// @Router /.well-known/openid-configuration [get]
+func (h *OIDCHandler) Discovery(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.Discovery())
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Публичные ключи для проверки подписи ID токенов
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} auth.JSONWebKeySet "Public keys"
+// @Router /.well-known/jwks.json [get]
+func (h *OIDCHandler) JWKS(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.JWKS())
+}
+
+// UserInfo godoc
+// @Summary OIDC UserInfo
+// @Description Claims пользователя, которому выдан access token
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.UserInfoResponse "User claims"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Router /userinfo [get]
+func (h *OIDCHandler) UserInfo(c echo.Context) error {
+	userInfo, err := h.service.UserInfo(claimsFromContext(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, userInfo)
+}
+
+// EndSession godoc
+// @Summary OIDC End Session
+// @Description Завершение сессии по id_token_hint: refresh сессии пользователя у этого клиента отзываются, cookie сессии /login удаляется.
+// @Description post_logout_redirect_uri должен входить в redirect_uris клиента
+// @Tags oidc
+// @Param id_token_hint query string true "Previously issued ID token"
+// @Param client_id query string false "Client ID"
+// @Param post_logout_redirect_uri query string false "Redirect after logout"
+// @Param state query string false "Opaque client state"
+// @Success 204 "Session ended"
+// @Success 302 "Redirect to post_logout_redirect_uri"
+// @Failure 400 {object} response.OAuthErrorResponse "Invalid request"
+// @Router /logout [get]
+func (h *OIDCHandler) EndSession(c echo.Context) error {
+	var req request.EndSessionRequest
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, response.OAuthErrorResponse{Error: "invalid_request", ErrorDescription: err.Error()})
+	}
+
+	redirectURI, err := h.service.EndSession(req, clientInfo(c))
+	if err != nil {
+		return oauthError(c, err)
+	}
+	clearSessionCookie(c, h.cookies)
+	if redirectURI == "" {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.Redirect(http.StatusFound, redirectURI)
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"bytes"
+	"github.com/labstack/echo/v4"
+	"html/template"
+)
+
+// Страницы сервера авторизации для браузера: вход и подтверждение устройства.
+var pages = template.Must(template.New("layout").Parse(`{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.}}</title></head>
+<body>
+<h1>{{.}}</h1>{{end}}
+{{define "login"}}{{template "head" "Sign in"}}
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/login">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}">
+<label>User GUID <input name="guid" value="{{.GUID}}" required autofocus></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>{{end}}
+{{define "device"}}{{template "head" "Connect a device"}}
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<p>Enter the code shown on your device. Approve only if you started the sign in on that device yourself.</p>
+<form method="post" action="/device">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<label>Code <input name="user_code" value="{{.UserCode}}" required autofocus autocomplete="off"></label>
+<button type="submit" name="approve" value="true">Approve</button>
+<button type="submit" name="approve" value="false">Deny</button>
+</form>
+</body>
+</html>{{end}}
+{{define "message"}}{{template "head" .Title}}
+<p>{{.Text}}</p>
+</body>
+</html>{{end}}
+`))
+
+type loginPageData struct {
+	GUID      string
+	ReturnTo  string
+	CSRFToken string
+	Error     string
+}
+
+type devicePageData struct {
+	UserCode  string
+	CSRFToken string
+	Error     string
+}
+
+type messagePageData struct {
+	Title string
+	Text  string
+}
+
+// renderPage запрещает показывать страницы во фрейме: кнопки подтверждения не должны быть доступны для clickjacking.
+func renderPage(c echo.Context, status int, name string, data interface{}) error {
+	var body bytes.Buffer
+	if err := pages.ExecuteTemplate(&body, name, data); err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	header.Set("Cache-Control", "no-store")
+	return c.HTMLBlob(status, body.Bytes())
+}
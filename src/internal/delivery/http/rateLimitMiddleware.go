@@ -0,0 +1,171 @@
+package http
+
+import (
+	"JwtTestTask/src/pkg/config"
+	"JwtTestTask/src/pkg/logger"
+	"JwtTestTask/src/pkg/ratelimit"
+	"bytes"
+	"encoding/json"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Действия, по которым ведутся лимиты. Устаревший маршрут и его замена в /api/v1 (а /login и /api/v1/sessions)
+// делят одно ведро: иначе каждый новый маршрут давал бы ещё один бюджет на подбор.
+const (
+	RateLimitSignIn       = "sign_in"
+	RateLimitSignUp       = "sign_up"
+	RateLimitRefresh      = "refresh"
+	RateLimitEmailChange  = "email_change"
+	RateLimitEmailConfirm = "email_confirm"
+)
+
+// maxPeekBodySize — сколько байт body читается, чтобы найти ключ лимита. Больший body лимитом по учётной
+// записи не учитывается и передаётся обработчику целиком.
+const maxPeekBodySize = 64 << 10
+
+type rateLimitCheck struct {
+	key  string
+	rule ratelimit.Rule
+}
+
+// AccountKeyFunc извлекает из запроса идентификатор учётной записи для лимита per-account.
+// Пустая строка означает, что лимит по учётной записи к запросу не применяется.
+type AccountKeyFunc func(c echo.Context) string
+
+func RateLimitMiddleware(store ratelimit.Store, params config.RateLimitParams, action string, accountKey AccountKeyFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			now := time.Now()
+			scope := action
+
+			// Глобальное ведро проверяется последним: запросы, отклонённые лимитом по IP или учётной записи,
+			// не должны тратить общий бюджет, иначе один клиент исчерпает его для всех.
+			checks := []rateLimitCheck{
+				{key: "ip:" + scope + ":" + remoteHost(c), rule: params.IP},
+			}
+			if accountKey != nil {
+				if account := accountKey(c); account != "" {
+					checks = append(checks, rateLimitCheck{key: "account:" + scope + ":" + account, rule: params.Account})
+				}
+			}
+			checks = append(checks, rateLimitCheck{key: "global:" + scope, rule: params.Global})
+
+			var strictest *ratelimit.Result
+			for _, check := range checks {
+				if !check.rule.Enabled() {
+					continue
+				}
+				result, err := store.Take(check.key, check.rule, now)
+				if err != nil {
+					logger.Log.Errorf("Ошибка rate limit хранилища: %v", err)
+					continue
+				}
+				if strictest == nil || !result.Allowed || (strictest.Allowed && result.Remaining < strictest.Remaining) {
+					strictest = &result
+				}
+				if !result.Allowed {
+					break
+				}
+			}
+
+			if strictest == nil {
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(strictest.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(strictest.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(strictest.Reset)))
+
+			if !strictest.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(strictest.RetryAfter)))
+				return ErrRateLimited
+			}
+			return next(c)
+		}
+	}
+}
+
+func AccountFromQuery(param string) AccountKeyFunc {
+	return func(c echo.Context) string {
+		return strings.ToLower(strings.TrimSpace(c.QueryParam(param)))
+	}
+}
+
+func AccountFromForm(field string) AccountKeyFunc {
+	return func(c echo.Context) string {
+		return strings.ToLower(strings.TrimSpace(c.FormValue(field)))
+	}
+}
+
+// AccountFromBody берёт идентификатор из строкового поля JSON body, не мешая последующему Bind.
+func AccountFromBody(field string) AccountKeyFunc {
+	return func(c echo.Context) string {
+		return strings.ToLower(strings.TrimSpace(peekBodyField(c, field)))
+	}
+}
+
+// AccountFromAccessToken берёт subject из access token без проверки подписи:
+// значение используется только как ключ лимита, подпись проверит сервис.
+func AccountFromAccessToken() AccountKeyFunc {
+	return func(c echo.Context) string {
+		token, _ := accessTokenFromHeader(c)
+		if token == "" {
+			token = peekBodyField(c, "access_token")
+		}
+		if token == "" {
+			return ""
+		}
+
+		claims := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+			return ""
+		}
+		subject, _ := claims["sub"].(string)
+		return subject
+	}
+}
+
+// peekBodyField читает не больше maxPeekBodySize байт неаутентифицированного body и возвращает прочитанное
+// обратно в начало body для Bind.
+func peekBodyField(c echo.Context, field string) string {
+	request := c.Request()
+	if request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(request.Body, maxPeekBodySize+1))
+	request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+	if err != nil || len(body) > maxPeekBodySize {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	value, _ := fields[field].(string)
+	return value
+}
+
+// remoteHost не доверяет X-Forwarded-For, иначе лимит по IP обходится подменой заголовка.
+func remoteHost(c echo.Context) string {
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
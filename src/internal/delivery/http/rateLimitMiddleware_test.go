@@ -0,0 +1,114 @@
+package http
+
+import (
+	"JwtTestTask/src/pkg/config"
+	"JwtTestTask/src/pkg/ratelimit"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	// Лимит только по учётной записи: две попытки на действие.
+	params := config.RateLimitParams{Account: ratelimit.PerMinute(2, 2)}
+
+	tests := []struct {
+		name     string
+		requests []rateLimitRequest
+		want     []bool
+	}{
+		{
+			name: "legacy and v1 routes share the action bucket",
+			requests: []rateLimitRequest{
+				{path: "/api/v1/sessions", action: RateLimitSignIn, body: `{"guid":"A"}`},
+				{path: "/signIn", action: RateLimitSignIn, query: "guid=a"},
+				{path: "/login", action: RateLimitSignIn, body: `{"guid":"a"}`},
+			},
+			want: []bool{true, true, false},
+		},
+		{
+			name: "actions have separate buckets",
+			requests: []rateLimitRequest{
+				{path: "/api/v1/sessions", action: RateLimitSignIn, body: `{"guid":"a"}`},
+				{path: "/api/v1/sessions", action: RateLimitSignIn, body: `{"guid":"a"}`},
+				{path: "/api/v1/users", action: RateLimitSignUp, body: `{"guid":"a"}`},
+			},
+			want: []bool{true, true, true},
+		},
+		{
+			name: "accounts have separate buckets",
+			requests: []rateLimitRequest{
+				{path: "/api/v1/sessions", action: RateLimitSignIn, body: `{"guid":"a"}`},
+				{path: "/api/v1/sessions", action: RateLimitSignIn, body: `{"guid":"a"}`},
+				{path: "/api/v1/sessions", action: RateLimitSignIn, body: `{"guid":"b"}`},
+			},
+			want: []bool{true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := ratelimit.NewMemoryStore()
+			for i, req := range tt.requests {
+				accountKey := AccountFromBody("guid")
+				if req.query != "" {
+					accountKey = AccountFromQuery("guid")
+				}
+				err := req.serve(RateLimitMiddleware(store, params, req.action, accountKey))
+				if allowed := !errors.Is(err, ErrRateLimited); allowed != tt.want[i] {
+					t.Errorf("request %d to %s: allowed = %v, want %v", i, req.path, allowed, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPeekBodyFieldLimitsRead(t *testing.T) {
+	large := `{"guid":"a","padding":"` + strings.Repeat("x", maxPeekBodySize) + `"}`
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"small body", `{"guid":"a"}`, "a"},
+		{"not json", `guid=a`, ""},
+		{"body over limit", large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)), httptest.NewRecorder())
+			if got := peekBodyField(c, "guid"); got != tt.want {
+				t.Errorf("peekBodyField = %q, want %q", got, tt.want)
+			}
+			rest, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rest) != tt.body {
+				t.Errorf("body was not restored for the handler: got %d bytes, want %d", len(rest), len(tt.body))
+			}
+		})
+	}
+}
+
+type rateLimitRequest struct {
+	path   string
+	action string
+	query  string
+	body   string
+}
+
+func (r rateLimitRequest) serve(middleware echo.MiddlewareFunc) error {
+	target := r.path
+	if r.query != "" {
+		target += "?" + r.query
+	}
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(r.body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.SetPath(r.path)
+	return middleware(func(c echo.Context) error { return nil })(c)
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "session"
+	formCSRFField     = "csrf_token"
+)
+
+// setSessionCookie сохраняет access token браузерной сессии сервера авторизации. SameSite=Lax вместо
+// COOKIE_SAME_SITE: на /authorize браузер приходит переходом из SPA или мобильного приложения,
+// а Strict cookie при таком переходе не отправляется.
+func setSessionCookie(c echo.Context, params config.CookieParams, accessToken string) {
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    accessToken,
+		Path:     "/",
+		Domain:   params.Domain,
+		Secure:   params.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSessionCookie(c echo.Context, params config.CookieParams) {
+	c.SetCookie(&http.Cookie{Name: sessionCookieName, Path: "/", Domain: params.Domain, MaxAge: -1, Expires: time.Unix(0, 0), Secure: params.Secure, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
+
+// BrowserAuthMiddleware аутентифицирует браузер по cookie сессии, которую выставляет /login. Запрос с заголовком
+// Authorization проверяется как в AuthMiddleware. Без сессии браузер перенаправляется на /login и возвращается после входа.
+func BrowserAuthMiddleware(parser auth.TokenParserInterface) echo.MiddlewareFunc {
+	authMiddleware := AuthMiddleware(parser)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withHeader := authMiddleware(next)
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+				return withHeader(c)
+			}
+			if cookie, err := c.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+				if claims, err := parser.Parse(cookie.Value); err == nil {
+					c.Set(claimsContextKey, claims)
+					return next(c)
+				}
+			}
+			return c.Redirect(http.StatusFound, "/login?return_to="+url.QueryEscape(c.Request().URL.RequestURI()))
+		}
+	}
+}
+
+// localPath пропускает только путь на этом же сервере, чтобы return_to нельзя было использовать как открытый redirect.
+// Браузеры выбрасывают из URL табуляции и переводы строк и считают обратную косую черту прямой, поэтому
+// "/\t/evil.com" или "/\evil.com" превращаются в "//evil.com". Такие символы запрещены и в исходном значении,
+// и в раскодированном пути.
+func localPath(target string) string {
+	if unsafeRedirectChars(target) {
+		return ""
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.User != nil || parsed.Opaque != "" {
+		return ""
+	}
+	if unsafeRedirectChars(parsed.Path) || !strings.HasPrefix(parsed.Path, "/") || strings.HasPrefix(parsed.Path, "//") {
+		return ""
+	}
+	return target
+}
+
+func unsafeRedirectChars(value string) bool {
+	return strings.ContainsFunc(value, func(r rune) bool {
+		return r < 0x20 || r == 0x7f || r == '\\'
+	})
+}
+
+// formCSRFToken возвращает CSRF токен для HTML формы: значение cookie csrf_token, которое форма отправляет
+// обратно в скрытом поле (double-submit, как X-CSRF-Token в cookie режиме).
+func formCSRFToken(c echo.Context, params config.CookieParams) (string, error) {
+	if cookie, err := c.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	csrfBytes := make([]byte, 32)
+	if _, err := rand.Read(csrfBytes); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(csrfBytes)
+	c.SetCookie(&http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   params.Domain,
+		Secure:   params.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+func validFormCSRF(c echo.Context) bool {
+	cookie, err := c.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(c.FormValue(formCSRFField))) == 1
+}
@@ -0,0 +1,33 @@
+package http
+
+import "testing"
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"path", "/authorize?client_id=app&state=1", "/authorize?client_id=app&state=1"},
+		{"root", "/", "/"},
+		{"empty", "", ""},
+		{"relative", "authorize", ""},
+		{"absolute url", "https://evil.com/", ""},
+		{"scheme relative", "//evil.com", ""},
+		{"backslash", "/\\evil.com", ""},
+		{"encoded backslash", "/%5cevil.com", ""},
+		{"tab", "/\t/evil.com", ""},
+		{"encoded tab", "/%09/evil.com", ""},
+		{"encoded newline", "/%0a/evil.com", ""},
+		{"encoded slash", "/%2f/evil.com", ""},
+		{"javascript", "javascript:alert(1)", ""},
+		{"invalid escape", "/%zz", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localPath(tt.target); got != tt.want {
+				t.Errorf("localPath(%q) = %q, want %q", tt.target, got, tt.want)
+			}
+		})
+	}
+}
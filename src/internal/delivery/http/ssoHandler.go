@@ -0,0 +1,120 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/config"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+const ssoStateCookieName = "sso_state"
+
+type SSOHandler struct {
+	service service.SSOServiceInterface
+	cookies config.CookieParams
+}
+
+func NewSSOHandler(service service.SSOServiceInterface, cookies config.CookieParams) *SSOHandler {
+	return &SSOHandler{service: service, cookies: cookies}
+}
+
+type SSOHandlerInterface interface {
+	Login(c echo.Context) error
+	Link(c echo.Context) error
+	Callback(c echo.Context) error
+}
+
+// Login godoc
+// @Summary Вход через внешнего провайдера
+// @Description Перенаправляет на страницу авторизации внешнего OIDC провайдера. State сохраняется в HttpOnly cookie sso_state:
+// @Description callback принимается только в том же браузере
+// @Tags sso
+// @Param provider path string true "Provider name"
+// @Param return_to query string false "Local path to return to after sign in"
+// @Success 302 "Redirect to provider"
+// @Failure 404 {object} response.ProblemResponse "Unknown provider"
+// @Router /sso/{provider}/login [get]
+func (h *SSOHandler) Login(c echo.Context) error {
+	return h.redirect(c, "")
+}
+
+// Link godoc
+// @Summary Привязка внешнего провайдера
+// @Description Привязывает внешнюю учётную запись к пользователю текущей сессии после входа у провайдера.
+// @Description Так привязываются существующие учётные записи с неподтверждённым email. Без сессии браузер перенаправляется на /login
+// @Tags sso
+// @Param provider path string true "Provider name"
+// @Param return_to query string false "Local path to return to after linking"
+// @Success 302 "Redirect to provider"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 404 {object} response.ProblemResponse "Unknown provider"
+// @Router /sso/{provider}/link [get]
+func (h *SSOHandler) Link(c echo.Context) error {
+	return h.redirect(c, claimsFromContext(c).Subject)
+}
+
+// Callback godoc
+// @Summary Завершение входа через внешнего провайдера
+// @Description Обменивает код провайдера на ID токен, находит, создаёт или привязывает пользователя, выставляет HttpOnly cookie session,
+// @Description как /login, и перенаправляет на return_to. При первом входе учётная запись привязывается по подтверждённому email
+// @Tags sso
+// @Produce html
+// @Param provider path string true "Provider name"
+// @Param state query string true "State from login redirect"
+// @Param code query string true "Authorization code from provider"
+// @Success 303 "Redirect to return_to"
+// @Success 200 "Signed in"
+// @Failure 400 {object} response.ProblemResponse "Invalid callback"
+// @Failure 403 {object} response.ProblemResponse "Account cannot be linked"
+// @Router /sso/{provider}/callback [get]
+func (h *SSOHandler) Callback(c echo.Context) error {
+	var browserState string
+	if cookie, err := c.Cookie(ssoStateCookieName); err == nil {
+		browserState = cookie.Value
+	}
+	h.setStateCookie(c, "", -1)
+
+	if errParam := c.QueryParam("error"); errParam != "" {
+		return service.WithDetail(service.ErrInvalidRequest, errParam)
+	}
+
+	result, err := h.service.Callback(c.Param("provider"), c.QueryParam("state"), browserState, c.QueryParam("code"), clientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	setSessionCookie(c, h.cookies, result.AccessToken)
+	if returnTo := localPath(result.ReturnTo); returnTo != "" {
+		return c.Redirect(http.StatusSeeOther, returnTo)
+	}
+	return renderPage(c, http.StatusOK, "message", messagePageData{Title: "Signed in", Text: "You are signed in. You can close this page."})
+}
+
+func (h *SSOHandler) redirect(c echo.Context, linkUserGUID string) error {
+	loginURL, state, err := h.service.LoginURL(c.Param("provider"), linkUserGUID, localPath(c.QueryParam("return_to")))
+	if err != nil {
+		return err
+	}
+	h.setStateCookie(c, state, int(service.SSOStateTTL.Seconds()))
+	return c.Redirect(http.StatusFound, loginURL)
+}
+
+// setStateCookie привязывает state к браузеру. SameSite=Lax: провайдер возвращает браузер на callback
+// межсайтовым переходом верхнего уровня, Strict cookie при нём не отправляется.
+func (h *SSOHandler) setStateCookie(c echo.Context, state string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     ssoStateCookieName,
+		Value:    state,
+		Path:     "/sso/",
+		Domain:   h.cookies.Domain,
+		MaxAge:   maxAge,
+		Secure:   h.cookies.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		cookie.Expires = time.Unix(0, 0)
+	}
+	c.SetCookie(cookie)
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/service"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type TokenHandler struct {
+	service service.TokenServiceInterface
+}
+
+func NewTokenHandler(service service.TokenServiceInterface) *TokenHandler {
+	return &TokenHandler{service: service}
+}
+
+type TokenHandlerInterface interface {
+	CreateToken(c echo.Context) error
+	ListTokens(c echo.Context) error
+	RevokeToken(c echo.Context) error
+}
+
+// CreateToken godoc
+// @Summary Create Personal Access Token
+// @Description Выпуск долгоживущего токена для скриптов. Токен показывается один раз и передаётся как `Authorization: Bearer jtt_pat_...`.
+// @Description Scope `admin` доступен только администраторам. Создать токен можно только с access token активного пользователя, не с PAT или API ключом
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param token body request.PersonalAccessTokenRequest true "Token"
+// @Success 201 {object} response.PersonalAccessTokenResponse "Created token"
+// @Failure 400 {object} response.ProblemResponse "Invalid request"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden or account disabled"
+// @Router /personal-tokens [post]
+func (h *TokenHandler) CreateToken(c echo.Context) error {
+	var req request.PersonalAccessTokenRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+
+	token, err := h.service.Create(claimsFromContext(c), req, clientInfo(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, token)
+}
+
+// ListTokens godoc
+// @Summary List Personal Access Tokens
+// @Description Токены текущего пользователя, включая отозванные и истёкшие. Сами токены не возвращаются
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} domain.PersonalAccessToken "Tokens"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Router /personal-tokens [get]
+func (h *TokenHandler) ListTokens(c echo.Context) error {
+	tokens, err := h.service.List(claimsFromContext(c).Subject)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken godoc
+// @Summary Revoke Personal Access Token
+// @Description Отзыв токена текущего пользователя, действует немедленно
+// @Tags tokens
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 204 "Token revoked"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 404 {object} response.ProblemResponse "Token not found"
+// @Router /personal-tokens/{id} [delete]
+func (h *TokenHandler) RevokeToken(c echo.Context) error {
+	if err := h.service.Revoke(claimsFromContext(c).Subject, c.Param("id"), clientInfo(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
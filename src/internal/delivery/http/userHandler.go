@@ -2,156 +2,385 @@ package http
 
 import (
 	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/payload/request"
 	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/repository"
 	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/pkg/config"
+	"JwtTestTask/src/pkg/mtls"
 	"github.com/labstack/echo/v4"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderRefreshToken = "X-Refresh-Token"
+	grantRefreshToken  = "refresh_token"
 )
 
 type UserHandler struct {
-	service service.UserServiceInterface
+	service   service.UserServiceInterface
+	cookies   config.CookieParams
+	transport config.TokenTransportParams
 }
 
-func NewUserHandler(service service.UserServiceInterface) *UserHandler {
-	return &UserHandler{service: service}
+func NewUserHandler(service service.UserServiceInterface, cookies config.CookieParams, transport config.TokenTransportParams) *UserHandler {
+	return &UserHandler{service: service, cookies: cookies, transport: transport}
 }
 
 type UserHandlerInterface interface {
+	CreateUser(c echo.Context) error
+	CreateSession(c echo.Context) error
+	RefreshSession(c echo.Context) error
+	ListUsers(c echo.Context) error
 	UserSignIn(c echo.Context) error
 	UserSignUp(c echo.Context) error
 	RefreshTokens(c echo.Context) error
 	GetAll(c echo.Context) error
 }
 
+// CreateSession godoc
+// @Summary Create Session
+// @Description Выдача access & refresh токенов по GUID user.
+// @Description При delivery=cookie refresh token выставляется в HttpOnly cookie для /api/v1/tokens вместе с CSRF cookie, в body возвращается только access token
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param session body request.SignInRequest true "User GUID and delivery mode"
+// @Param DPoP header string false "DPoP proof JWT: binds issued tokens to the client key (RFC 9449)"
+// @Success 200 {object} response.JwtResponse "Successful response"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Failure 423 {object} response.ProblemResponse "Account locked"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Header 429 {integer} Retry-After "Seconds until the next request is allowed"
+// @Router /api/v1/sessions [post]
+func (h *UserHandler) CreateSession(c echo.Context) error {
+	var req request.SignInRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+	return h.signIn(c, req, refreshCookiePath)
+}
+
 // UserSignIn godoc
 // @Summary User Sign In
-// @Description Выдача access & refresh токенов по GUID user
+// @Description Устаревший вариант POST /api/v1/sessions: GUID передаётся в query string и попадает в логи.
+// @Description Отключается LEGACY_ROUTES_ENABLED=false, ответ содержит заголовки Deprecation, Sunset и Link на новый эндпоинт
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param guid query string true "User GUID"
+// @Param delivery query string false "Token delivery mode" Enums(body, cookie) default(body)
+// @Param DPoP header string false "DPoP proof JWT: binds issued tokens to the client key (RFC 9449)"
 // @Success 200 {object} response.JwtResponse "Successful response"
-// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Failure 400 {object} response.ProblemResponse "Invalid GUID"
+// @Failure 404 {object} response.ProblemResponse "User not found"
+// @Failure 423 {object} response.ProblemResponse "Account locked"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Header 429 {integer} Retry-After "Seconds until the next request is allowed"
+// @Deprecated
 // @Router /signIn [post]
 func (h *UserHandler) UserSignIn(c echo.Context) error {
-	guid := c.QueryParam("guid")
-	ip := c.Request().RemoteAddr
-	tokens, err := h.service.SignIn(guid, ip)
+	var req request.SignInRequest
+	if err := bindQuery(c, &req); err != nil {
+		return err
+	}
+	return h.signIn(c, req, legacyRefreshCookiePath)
+}
+
+func (h *UserHandler) signIn(c echo.Context, req request.SignInRequest, cookiePath string) error {
+	tokens, err := h.service.SignIn(req.GUID, clientInfo(c))
 	if err != nil {
-		errorResponse := response.ErrorResponse{Error: err.Error()}
-		return c.JSON(http.StatusNotFound, errorResponse)
+		return err
 	}
 
+	if req.Delivery == DeliveryCookie {
+		return h.respondWithCookies(c, tokens, cookiePath)
+	}
 	return c.JSON(http.StatusOK, tokens)
 }
 
+// CreateUser godoc
+// @Summary Create User
+// @Description Создание пользователя по email
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body request.SignUpRequest true "User email"
+// @Success 201 {object} nil "User created successfully"
+// @Failure 400 {object} response.ProblemResponse "Invalid email"
+// @Failure 409 {object} response.ProblemResponse "Email already registered"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Header 429 {integer} Retry-After "Seconds until the next request is allowed"
+// @Router /api/v1/users [post]
+func (h *UserHandler) CreateUser(c echo.Context) error {
+	var req request.SignUpRequest
+	if err := bindRequest(c, &req); err != nil {
+		return err
+	}
+	return h.signUp(c, req)
+}
+
 // UserSignUp godoc
 // @Summary User Sign Up
-// @Description Создание пользователя по email
+// @Description Устаревший вариант POST /api/v1/users: email передаётся в query string
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param email query string true "User Email"
 // @Success 201 {object} nil "User created successfully"
-// @Failure 400 {object} response.ErrorResponse "Email is required"
-// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Failure 400 {object} response.ProblemResponse "Invalid email"
+// @Failure 409 {object} response.ProblemResponse "Email already registered"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Header 429 {integer} Retry-After "Seconds until the next request is allowed"
+// @Deprecated
 // @Router /signUp [post]
 func (h *UserHandler) UserSignUp(c echo.Context) error {
-	email := c.QueryParam("email")
-	if email == "" {
-		errorResponse := response.ErrorResponse{Error: "email is required"}
-		return c.JSON(http.StatusBadRequest, errorResponse)
+	var req request.SignUpRequest
+	if err := bindQuery(c, &req); err != nil {
+		return err
 	}
-	err := h.service.SignUp(email)
-	if err != nil {
-		errorResponse := response.ErrorResponse{Error: err.Error()}
-		return c.JSON(http.StatusNotFound, errorResponse)
+	return h.signUp(c, req)
+}
+
+func (h *UserHandler) signUp(c echo.Context, req request.SignUpRequest) error {
+	if err := h.service.SignUp(req.Email, clientInfo(c)); err != nil {
+		return err
 	}
 	return c.NoContent(http.StatusCreated)
 }
 
-// RefreshTokens godoc
+// RefreshSession godoc
 // @Summary Refresh JWT Tokens
 // @Description Обновление токенов по паре access & refresh tokens.
 // @Description При смене ip высылается email warning на почту указанную при создании и refresh токен в базе обнуляется.
-// @Description Токены были перенесены из headers в body для удобства отладки и проверки задания
+// @Description Токены передаются в JSON body, access token также принимается в `Authorization: Bearer`, refresh token — в заголовке X-Refresh-Token
+// @Description или form-encoded body `grant_type=refresh_token&refresh_token=...` (RFC 6749, раздел 6).
+// @Description Если refresh token не передан, он берётся из cookie, выставленной POST /api/v1/sessions с delivery=cookie. В этом случае обязателен заголовок X-CSRF-Token со значением cookie csrf_token,
+// @Description новый refresh token снова выставляется в cookie, а в body возвращается только access token
 // @Tags users
-// @Accept json
+// @Accept json,x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string false "Bearer access token"
+// @Param X-Refresh-Token header string false "Refresh token"
+// @Param tokensRequest body request.RefreshRequest false "Tokens"
+// @Param X-CSRF-Token header string false "CSRF token from csrf_token cookie (cookie mode only)"
+// @Param DPoP header string false "DPoP proof JWT, required for DPoP-bound tokens (Authorization: DPoP <token>)"
+// @Success 200 {object} response.JwtResponse "Successful response with new tokens"
+// @Failure 400 {object} response.ProblemResponse "Invalid request"
+// @Failure 401 {object} response.ProblemResponse "Invalid, expired or mismatched tokens"
+// @Failure 403 {object} response.ProblemResponse "CSRF token mismatch"
+// @Failure 423 {object} response.ProblemResponse "Account locked"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Header 429 {integer} Retry-After "Seconds until the next request is allowed"
+// @Router /api/v1/tokens [post]
+func (h *UserHandler) RefreshSession(c echo.Context) error {
+	return h.refresh(c, true, refreshCookiePath)
+}
+
+// RefreshTokens godoc
+// @Summary Refresh JWT Tokens
+// @Description Устаревший вариант POST /api/v1/tokens. Передача обоих токенов в JSON body здесь отключается REFRESH_BODY_FALLBACK=false,
+// @Description cookie режим работает с cookie, выставленной устаревшим /signIn
+// @Tags users
+// @Accept json,x-www-form-urlencoded
 // @Produce json
-// @Param tokensRequest body response.JwtResponse true "Tokens Request"
+// @Param Authorization header string false "Bearer access token"
+// @Param X-Refresh-Token header string false "Refresh token"
+// @Param tokensRequest body request.RefreshRequest false "Tokens in body (fallback mode)"
+// @Param X-CSRF-Token header string false "CSRF token from csrf_token cookie (cookie mode only)"
+// @Param DPoP header string false "DPoP proof JWT, required for DPoP-bound tokens (Authorization: DPoP <token>)"
 // @Success 200 {object} response.JwtResponse "Successful response with new tokens"
-// @Failure 400 {object} response.ErrorResponse "Invalid request or tokens"
-// @Failure 400 {object} response.ErrorResponse "refresh token expired"
+// @Failure 400 {object} response.ProblemResponse "Invalid request"
+// @Failure 401 {object} response.ProblemResponse "Invalid, expired or mismatched tokens"
+// @Failure 403 {object} response.ProblemResponse "CSRF token mismatch"
+// @Failure 423 {object} response.ProblemResponse "Account locked"
+// @Failure 429 {object} response.ProblemResponse "Too many requests"
+// @Header 429 {integer} Retry-After "Seconds until the next request is allowed"
+// @Deprecated
 // @Router /refresh [post]
 func (h *UserHandler) RefreshTokens(c echo.Context) error {
-	var tokensRequest response.JwtResponse
-	ip := c.Request().RemoteAddr
+	return h.refresh(c, h.transport.BodyFallback, legacyRefreshCookiePath)
+}
+
+// refresh собирает токены из заголовков, form body, cookie и, если bodyTokens, из JSON body.
+func (h *UserHandler) refresh(c echo.Context, bodyTokens bool, cookiePath string) error {
+	var tokensRequest request.RefreshRequest
 
 	if err := c.Bind(&tokensRequest); err != nil {
-		errorResponse := response.ErrorResponse{Error: err.Error()}
-		return c.JSON(http.StatusBadRequest, errorResponse)
+		return invalidRequest(err)
+	}
+
+	formEncoded := strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationForm)
+	if formEncoded && tokensRequest.GrantType != grantRefreshToken {
+		return service.WithDetail(service.ErrInvalidRequest, "unsupported grant type")
+	}
+
+	accessToken, _ := accessTokenFromHeader(c)
+	if accessToken == "" && bodyTokens {
+		accessToken = tokensRequest.AccessToken
+	}
+
+	refreshToken := c.Request().Header.Get(HeaderRefreshToken)
+	if refreshToken == "" && (formEncoded || bodyTokens) {
+		refreshToken = tokensRequest.RefreshToken
+	}
+
+	cookieMode := false
+	if refreshToken == "" {
+		if cookieToken := refreshTokenFromCookie(c); cookieToken != "" {
+			if !validCSRF(c) {
+				return ErrCSRFMismatch
+			}
+			refreshToken = cookieToken
+			cookieMode = true
+		}
+	}
+
+	if accessToken == "" || refreshToken == "" {
+		return service.WithDetail(service.ErrInvalidRequest, "access and refresh tokens are required")
 	}
-	tokens, err := h.service.RefreshTokens(tokensRequest.AccessToken, tokensRequest.RefreshToken, ip)
+
+	tokens, err := h.service.RefreshTokens(accessToken, refreshToken, clientInfo(c))
 	if err != nil {
-		errorResponse := response.ErrorResponse{Error: err.Error()}
-		return c.JSON(http.StatusBadRequest, errorResponse)
+		if cookieMode {
+			clearTokenCookies(c, h.cookies, cookiePath)
+		}
+		return err
+	}
+
+	if cookieMode {
+		return h.respondWithCookies(c, tokens, cookiePath)
 	}
 	return c.JSON(http.StatusOK, tokens)
 }
 
+func (h *UserHandler) respondWithCookies(c echo.Context, tokens response.JwtResponse, cookiePath string) error {
+	if err := setTokenCookies(c, h.cookies, cookiePath, tokens.RefreshToken); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, response.AccessTokenResponse{AccessToken: tokens.AccessToken})
+}
+
+// ListUsers godoc
+// @Summary List Users
+// @Description Получение пользователей с фильтрами, сортировкой и курсорной пагинацией, только для администраторов.
+// @Description Секретные поля (хеш refresh token, привязки токенов) не возвращаются, fields=guid,email ограничивает набор полей в ответе.
+// @Description next_cursor передаётся в cursor для следующей страницы с той же сортировкой, total считается только при include_total=true
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param email query string false "Email contains (case-insensitive)"
+// @Param created_from query string false "Created at or after (RFC3339)"
+// @Param created_to query string false "Created before (RFC3339)"
+// @Param has_active_session query boolean false "Has an unexpired refresh session"
+// @Param verified query boolean false "Email verified"
+// @Param status query string false "Account status, deleted users are excluded unless status=deleted" Enums(active, disabled, pending, deleted)
+// @Param sort query string false "Sort key, '-' for descending" Enums(created_at, -created_at, email, -email) default(-created_at)
+// @Param cursor query string false "Cursor from previous page"
+// @Param limit query int false "Number of users per page" default(20) minimum(1) maximum(100)
+// @Param include_total query boolean false "Count users matching filters" default(false)
+// @Param fields query string false "Comma-separated fields: guid, email, email_verified, role, locked_until, status, created_at"
+// @Success 200 {object} response.UserListResponse "Successful response with user list"
+// @Failure 400 {object} response.ProblemResponse "Invalid filter, sort, cursor or fields"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 500 {object} response.ProblemResponse "Internal server error"
+// @Router /api/v1/users [get]
+func (h *UserHandler) ListUsers(c echo.Context) error {
+	req := request.ListUsersRequest{Sort: "-created_at", Limit: 20}
+	if err := bindQuery(c, &req); err != nil {
+		return err
+	}
+
+	// Формат полей уже проверен валидатором.
+	filter := repository.UserFilter{EmailContains: req.Email, Status: req.Status}
+	if req.CreatedFrom != "" {
+		from, _ := time.Parse(time.RFC3339, req.CreatedFrom)
+		filter.CreatedFrom = &from
+	}
+	if req.CreatedTo != "" {
+		to, _ := time.Parse(time.RFC3339, req.CreatedTo)
+		filter.CreatedTo = &to
+	}
+	if req.HasActiveSession != "" {
+		hasActiveSession := req.HasActiveSession == "true"
+		filter.HasActiveSession = &hasActiveSession
+	}
+	if req.Verified != "" {
+		verified := req.Verified == "true"
+		filter.Verified = &verified
+	}
+	sort := repository.UserSort{Field: strings.TrimPrefix(req.Sort, "-"), Desc: strings.HasPrefix(req.Sort, "-")}
+
+	users, nextCursor, total, err := h.service.List(filter, sort, req.Cursor, req.Limit, req.IncludeTotal)
+	if err != nil {
+		return err
+	}
+
+	fields := req.Fields.Split()
+	userResponse := make([]response.UserResponse, 0, len(users))
+	for _, user := range users {
+		userResponse = append(userResponse, response.NewUserResponse(user).Select(fields))
+	}
+
+	return c.JSON(http.StatusOK, response.UserListResponse{Users: userResponse, NextCursor: nextCursor, Total: total})
+}
+
 // GetAll godoc
 // @Summary Get All Users
-// @Description Получение всех пользователей с пагинацией. Вспомогательный эндпоинт для более удобного тестирования
+// @Description Устаревший вариант GET /api/v1/users с постраничной выдачей по номеру страницы, только для администраторов
 // @Tags users
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Param page query int false "Page number" default(1)
-// @Param limit query int false "Number of users per page" default(10)
+// @Param limit query int false "Number of users per page" default(10) minimum(1) maximum(100)
+// @Param fields query string false "Comma-separated fields: guid, email, email_verified, role, locked_until, status, created_at"
 // @Success 200 {object} response.UsersResponse "Successful response with user list"
-// @Failure 500 {object} response.ErrorResponse "Internal server error"
+// @Failure 400 {object} response.ProblemResponse "Invalid page, limit or fields"
+// @Failure 401 {object} response.ProblemResponse "Unauthorized"
+// @Failure 403 {object} response.ProblemResponse "Forbidden"
+// @Failure 500 {object} response.ProblemResponse "Internal server error"
+// @Deprecated
 // @Router /getAll [get]
 func (h *UserHandler) GetAll(c echo.Context) error {
-	pageStr := c.QueryParam("page")
-	limitStr := c.QueryParam("limit")
-
-	page := 1
-	limit := 10
-
-	if pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil {
-			page = p
-		}
-	}
-
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
+	req := request.PageRequest{Page: 1, Limit: 10}
+	if err := bindQuery(c, &req); err != nil {
+		return err
 	}
 
-	users, total, err := h.service.GetAll(page, limit)
+	users, total, err := h.service.GetAll(req.Page, req.Limit)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return err
 	}
 
-	var userResponse []domain.User
-
+	fields := req.Fields.Split()
+	userResponse := make([]response.UserResponse, 0, len(users))
 	for _, user := range users {
-		userResponse = append(userResponse, domain.User{
-			GUID:               user.GUID,
-			RefreshToken:       user.RefreshToken,
-			RefreshTokenExpiry: user.RefreshTokenExpiry,
-			Email:              user.Email,
-		})
+		userResponse = append(userResponse, response.NewUserResponse(user).Select(fields))
 	}
 
 	usersResponse := response.UsersResponse{
 		Total: int(total),
-		Page:  page,
-		Limit: limit,
+		Page:  req.Page,
+		Limit: req.Limit,
 		Users: userResponse,
 	}
 
 	return c.JSON(http.StatusOK, usersResponse)
 }
+
+func clientInfo(c echo.Context) domain.ClientInfo {
+	client := domain.ClientInfo{IP: c.Request().RemoteAddr, UserAgent: c.Request().UserAgent(), DPoPJKT: dpopThumbprint(c)}
+	if cert := clientCertificate(c); cert != nil {
+		client.CertThumbprint = mtls.Thumbprint(cert)
+		client.CertSubjectDN = cert.Subject.String()
+	}
+	return client
+}
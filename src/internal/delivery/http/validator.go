@@ -0,0 +1,146 @@
+package http
+
+import (
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/service"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ValidationError содержит ошибки по полям запроса и считается ErrInvalidRequest.
+type ValidationError struct {
+	Fields []response.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return service.ErrInvalidRequest
+}
+
+type RequestValidator struct {
+	validate *validator.Validate
+}
+
+// NewRequestValidator создаёт валидатор для Echo, который называет поля так же, как они
+// приходят в запросе (json, query, form или path).
+func NewRequestValidator() *RequestValidator {
+	validate := validator.New()
+	_ = validate.RegisterValidation("csvoneof", validateCSVOneOf)
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "query", "form", "param"} {
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+	return &RequestValidator{validate: validate}
+}
+
+// validateCSVOneOf проверяет, что каждый элемент списка через запятую входит в параметр тега.
+func validateCSVOneOf(fl validator.FieldLevel) bool {
+	allowed := strings.Fields(fl.Param())
+	for _, item := range strings.Split(fl.Field().String(), ",") {
+		if !slices.Contains(allowed, item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *RequestValidator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	fields := make([]response.FieldError, 0, len(fieldErrors))
+	for _, fieldError := range fieldErrors {
+		fields = append(fields, response.FieldError{
+			Field:   fieldPath(fieldError),
+			Rule:    fieldError.Tag(),
+			Message: fieldMessage(fieldError),
+		})
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// fieldPath убирает имя корневой структуры: SignUpRequest.email -> email, APIKeyRequest.allowed_ips[0] -> allowed_ips[0].
+func fieldPath(fieldError validator.FieldError) string {
+	namespace := fieldError.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func fieldMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid":
+		return "must be a valid uuid"
+	case "url":
+		return "must be a valid url"
+	case "ip|cidr":
+		return "must be an ip address or cidr"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fieldError.Param(), " ", ", ")
+	case "csvoneof":
+		return "must be a comma-separated list of: " + strings.ReplaceAll(fieldError.Param(), " ", ", ")
+	case "datetime":
+		return "must be an RFC3339 timestamp"
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fieldError.Param())
+		}
+		return "must be at least " + fieldError.Param()
+	case "max":
+		if fieldError.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fieldError.Param())
+		}
+		return "must be at most " + fieldError.Param()
+	default:
+		return "is invalid"
+	}
+}
+
+// bindRequest привязывает тело и параметры пути, затем нормализует и валидирует запрос.
+func bindRequest(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return invalidRequest(err)
+	}
+	return validateRequest(c, req)
+}
+
+// bindQuery привязывает query параметры независимо от метода запроса: c.Bind читает их только для GET и DELETE.
+func bindQuery(c echo.Context, req interface{}) error {
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, req); err != nil {
+		return invalidRequest(err)
+	}
+	return validateRequest(c, req)
+}
+
+func validateRequest(c echo.Context, req interface{}) error {
+	if normalizer, ok := req.(request.Normalizer); ok {
+		normalizer.Normalize()
+	}
+	return c.Validate(req)
+}
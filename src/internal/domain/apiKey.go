@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"net"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix начинает ключ вида jtt_key_<prefix>_<secret>. По prefix ключ ищется в базе,
+// secret сравнивается с хешем.
+const APIKeyPrefix = "jtt_key_"
+
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;uniqueIndex" json:"prefix"`
+	SecretHash string     `gorm:"not null" json:"-"`
+	Scopes     string     `gorm:"type:text" json:"scopes"`
+	AllowedIPs string     `gorm:"type:text" json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	UsageCount int64      `gorm:"not null;default:0" json:"usage_count"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// AllowsIP проверяет адрес по списку IP и CIDR. Пустой список разрешает любой адрес.
+func (k *APIKey) AllowsIP(ip string) bool {
+	entries := strings.Fields(k.AllowedIPs)
+	if len(entries) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
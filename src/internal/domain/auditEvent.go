@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AuditSignIn        = "sign_in"
+	AuditSignUp        = "sign_up"
+	AuditRefresh       = "refresh"
+	AuditIPWarning     = "ip_warning"
+	AuditLogout        = "logout"
+	AuditLocked        = "account_locked"
+	AuditUnlocked      = "account_unlocked"
+	AuditClientToken   = "client_token"
+	AuditExchange      = "token_exchange"
+	AuditLinked        = "identity_linked"
+	AuditPATCreated    = "pat_created"
+	AuditPATRevoked    = "pat_revoked"
+	AuditAPIKeyCreated = "api_key_created"
+	AuditAPIKeyRevoked = "api_key_revoked"
+	AuditEmailChanged  = "email_changed"
+	AuditEmailPending  = "email_change_requested"
+	AuditDisabled      = "account_disabled"
+	AuditEnabled       = "account_enabled"
+	AuditUserDeleted   = "user_deleted"
+
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+type AuditEvent struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Seq       int64      `gorm:"not null;uniqueIndex" json:"seq"`
+	UserGUID  *uuid.UUID `gorm:"type:uuid;index" json:"user_guid"`
+	EventType string     `gorm:"index" json:"event_type"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"user_agent"`
+	Result    string     `json:"result"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	PrevHash  string     `gorm:"type:char(64);not null" json:"prev_hash"`
+	Hash      string     `gorm:"type:char(64);not null" json:"hash"`
+}
+
+type AuditCheckpoint struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Seq       int64     `gorm:"not null;index" json:"seq"`
+	Hash      string    `gorm:"type:char(64);not null" json:"hash"`
+	Signature string    `gorm:"type:text;not null" json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ComputeHash считает хеш записи вместе с хешем предыдущей, поэтому изменение
+// любой записи ломает все последующие звенья цепочки.
+func (e *AuditEvent) ComputeHash() string {
+	userGUID := ""
+	if e.UserGUID != nil {
+		userGUID = e.UserGUID.String()
+	}
+
+	payload := strings.Join([]string{
+		e.PrevHash,
+		strconv.FormatInt(e.Seq, 10),
+		e.ID.String(),
+		userGUID,
+		e.EventType,
+		e.IP,
+		e.UserAgent,
+		e.Result,
+		e.Reason,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "\x1f")
+
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *AuditCheckpoint) SigningPayload() []byte {
+	return []byte(strconv.FormatInt(c.Seq, 10) + "|" + c.Hash + "|" + c.CreatedAt.UTC().Format(time.RFC3339Nano))
+}
@@ -0,0 +1,12 @@
+package domain
+
+// ClientInfo описывает источник запроса. DPoPJKT заполняется, если запрос содержит
+// проверенный DPoP proof, CertThumbprint и CertSubjectDN — если соединение предъявило
+// проверенный клиентский сертификат.
+type ClientInfo struct {
+	IP             string
+	UserAgent      string
+	DPoPJKT        string
+	CertThumbprint string
+	CertSubjectDN  string
+}
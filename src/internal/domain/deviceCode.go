@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeConsumed = "consumed"
+)
+
+type DeviceCode struct {
+	DeviceCodeHash string     `gorm:"primaryKey"`
+	UserCode       string     `gorm:"not null;uniqueIndex"`
+	ClientID       string     `gorm:"not null;index"`
+	Scope          string     `gorm:"type:text"`
+	Status         string     `gorm:"not null;default:'pending'"`
+	UserGUID       *uuid.UUID `gorm:"type:uuid"`
+	Interval       int        `gorm:"not null"`
+	ExpiresAt      time.Time  `gorm:"not null"`
+	LastPolledAt   *time.Time
+	CreatedAt      time.Time
+}
@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type ExternalIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Provider  string    `gorm:"not null;uniqueIndex:idx_provider_subject" json:"provider"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_provider_subject" json:"subject"`
+	UserGUID  uuid.UUID `gorm:"type:uuid;not null;index" json:"user_guid"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type OAuthClient struct {
+	ClientID               string    `gorm:"primaryKey" json:"client_id"`
+	Name                   string    `gorm:"not null" json:"name"`
+	Confidential           bool      `gorm:"not null;default:false" json:"confidential"`
+	SecretHash             string    `gorm:"type:text" json:"-"`
+	RedirectURIs           string    `gorm:"type:text;not null" json:"redirect_uris"`
+	GrantTypes             string    `gorm:"type:text;not null;default:'authorization_code'" json:"grant_types"`
+	Scopes                 string    `gorm:"type:text" json:"scopes"`
+	Audiences              string    `gorm:"type:text" json:"audiences"`
+	AccessTokenTTL         int       `gorm:"not null;default:0" json:"access_token_ttl"`
+	TLSClientAuthSubjectDN string    `gorm:"type:text" json:"tls_client_auth_subject_dn,omitempty"`
+	CreatedAt              time.Time `json:"created_at"`
+}
+
+type AuthorizationCode struct {
+	CodeHash            string    `gorm:"primaryKey"`
+	ClientID            string    `gorm:"not null;index"`
+	UserGUID            uuid.UUID `gorm:"type:uuid;not null"`
+	RedirectURI         string    `gorm:"type:text;not null"`
+	Scope               string    `gorm:"type:text"`
+	CodeChallenge       string    `gorm:"not null"`
+	CodeChallengeMethod string    `gorm:"not null"`
+	Nonce               string    `gorm:"type:text"`
+	ExpiresAt           time.Time `gorm:"not null"`
+	UsedAt              *time.Time
+	CreatedAt           time.Time
+}
+
+// HasRedirectURI сравнивает redirect_uri точно, без нормализации, как требует OAuth 2.1.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range strings.Fields(c.RedirectURIs) {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, allowed := range strings.Fields(c.GrantTypes) {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *OAuthClient) AllowsAudience(audience string) bool {
+	for _, allowed := range strings.Fields(c.Audiences) {
+		if allowed == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope проверяет, что каждый из запрошенных scope зарегистрирован у клиента.
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	return ScopeSubset(scope, c.Scopes)
+}
+
+// ScopeSubset проверяет, что все scope из requested входят в granted.
+func ScopeSubset(requested, granted string) bool {
+	allowed := strings.Fields(granted)
+	for _, r := range strings.Fields(requested) {
+		found := false
+		for _, s := range allowed {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
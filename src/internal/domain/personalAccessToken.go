@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// PersonalAccessTokenPrefix позволяет отличить PAT от JWT в заголовке Authorization
+// и найти случайно опубликованный токен сканерами секретов.
+const PersonalAccessTokenPrefix = "jtt_pat_"
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserGUID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	Hint       string     `gorm:"not null" json:"hint"`
+	Scope      string     `gorm:"type:text" json:"scope"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RefreshSession — выданный refresh token. Каждый вход и каждый OAuth клиент получают свою сессию,
+// поэтому новый вход или авторизация клиента не завершают остальные сессии пользователя.
+// Access token ссылается на сессию claim sid, в базе хранится только bcrypt хеш refresh token.
+type RefreshSession struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserGUID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	ClientID  string    `gorm:"not null;default:''"`
+	TokenHash string    `gorm:"not null"`
+	// JKT и X5T — ключ DPoP и сертификат, к которым привязан refresh token этой сессии.
+	JKT string `gorm:"type:text"`
+	X5T string `gorm:"type:text"`
+	// AuthCodeHash — код авторизации, по которому выдана сессия: при повторном предъявлении кода она отзывается.
+	AuthCodeHash string    `gorm:"type:text;index"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	// Счётчики блокировки после неудачных попыток обновления. Блокируется сессия, а не учётная запись:
+	// неверный refresh token для чужой сессии не мешает владельцу пользоваться остальными.
+	FailedAttempts int `gorm:"not null;default:0"`
+	LockoutCount   int `gorm:"not null;default:0"`
+	LockedUntil    *time.Time
+	CreatedAt      time.Time
+}
+
+func (s *RefreshSession) IsLocked(now time.Time) bool {
+	return s.LockedUntil != nil && now.Before(*s.LockedUntil)
+}
+
+func (s *RefreshSession) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
@@ -2,12 +2,42 @@ package domain
 
 import (
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Статусы учётной записи. Войти и обновить токены может только active, pending — учётная запись
+// ещё не активирована, deleted — мягко удалена и ждёт окончательного удаления.
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusPending  = "pending"
+	UserStatusDeleted  = "deleted"
+)
+
 type User struct {
-	GUID               uuid.UUID  `gorm:"type:uuid;primaryKey" json:"guid"`
-	RefreshToken       *string    `json:"refresh_token" gorm:"type:text"`
-	RefreshTokenExpiry *time.Time `json:"refresh_token_expiry" gorm:"type:timestamp"`
-	Email              string     `gorm:"unique" json:"email"`
+	GUID uuid.UUID `gorm:"type:uuid;primaryKey;index:idx_users_created_at_guid,priority:2" json:"guid"`
+	// Email уникален только среди неудалённых: мягко удалённый пользователь не мешает зарегистрироваться
+	// с тем же адресом до окончательного удаления.
+	Email         string `gorm:"uniqueIndex:idx_users_email_active,where:deleted_at IS NULL" json:"email"`
+	EmailVerified bool   `gorm:"not null;default:false" json:"email_verified"`
+	Role          string `gorm:"not null;default:'user'" json:"role"`
+	Status        string `gorm:"not null;default:'active';index" json:"status"`
+	// Новый email ждёт подтверждения кодом из письма, хранится только sha256 хеш кода.
+	PendingEmail         string     `gorm:"type:text" json:"-"`
+	EmailChangeTokenHash string     `gorm:"type:text" json:"-"`
+	EmailChangeExpiry    *time.Time `gorm:"type:timestamp" json:"-"`
+	// Составной индекс (created_at, guid) обслуживает сортировку и курсор списка пользователей.
+	CreatedAt time.Time `gorm:"not null;default:now();index:idx_users_created_at_guid,priority:1" json:"created_at"`
+	// DeletedAt включает мягкое удаление GORM: удалённые пользователи не находятся обычными запросами.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (u *User) IsActive() bool {
+	return u.Status == UserStatusActive
 }
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"gorm.io/gorm/schema"
+	"sync"
+	"testing"
+)
+
+// Email должен быть уникален только среди неудалённых пользователей, иначе мягко удалённая учётная
+// запись не даёт зарегистрироваться с тем же адресом до окончательного удаления.
+func TestUserEmailUniqueOnlyAmongNotDeleted(t *testing.T) {
+	parsed, err := schema.Parse(&User{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.LookUpField("Email").Unique {
+		t.Fatal("email must not have a table-wide unique constraint")
+	}
+
+	index, ok := parsed.ParseIndexes()["idx_users_email_active"]
+	if !ok {
+		t.Fatal("partial unique index on email is missing")
+	}
+	if index.Class != "UNIQUE" || index.Where != "deleted_at IS NULL" {
+		t.Errorf("index class = %q, where = %q", index.Class, index.Where)
+	}
+	if len(index.Fields) != 1 || index.Fields[0].DBName != "email" {
+		t.Errorf("unexpected index fields: %+v", index.Fields)
+	}
+}
@@ -0,0 +1,90 @@
+package event
+
+import (
+	"JwtTestTask/src/pkg/logger"
+	"fmt"
+	"sync"
+)
+
+const allEvents = "*"
+
+type Handler func(event Event) error
+
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+type BusInterface interface {
+	Subscribe(name string, handler Handler)
+	SubscribeAll(handler Handler)
+	Publish(event Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], handler)
+}
+
+func (b *Bus) SubscribeAll(handler Handler) {
+	b.Subscribe(allEvents, handler)
+}
+
+// Publish синхронно вызывает подписчиков. Ошибка одного подписчика не мешает остальным
+// и не возвращается в бизнес-логику, а только логируется. Подписчики с сетевыми вызовами
+// подписываются через Queue.
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[event.Name()])+len(b.handlers[allEvents]))
+	handlers = append(handlers, b.handlers[event.Name()]...)
+	handlers = append(handlers, b.handlers[allEvents]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(event); err != nil {
+			logger.Log.Errorf("Ошибка обработки события %s: %v", event.Name(), err)
+		}
+	}
+}
+
+// Queue выполняет обработчик подписчика в отдельной горутине, чтобы медленные подписчики (SMTP, webhook)
+// не задерживали запрос, опубликовавший событие. Очередь ограничена: при переполнении событие
+// отбрасывается, и Publish логирует ошибку.
+type Queue struct {
+	jobs chan queuedEvent
+}
+
+type queuedEvent struct {
+	handler Handler
+	event   Event
+}
+
+func NewQueue(size int) *Queue {
+	q := &Queue{jobs: make(chan queuedEvent, size)}
+	go q.run()
+	return q
+}
+
+func (q *Queue) Async(handler Handler) Handler {
+	return func(event Event) error {
+		select {
+		case q.jobs <- queuedEvent{handler: handler, event: event}:
+			return nil
+		default:
+			return fmt.Errorf("queue is full, event %s dropped", event.Name())
+		}
+	}
+}
+
+func (q *Queue) run() {
+	for job := range q.jobs {
+		if err := job.handler(job.event); err != nil {
+			logger.Log.Errorf("Ошибка обработки события %s: %v", job.event.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package event
+
+import "time"
+
+const (
+	UserSignedUpName         = "user.signed_up"
+	UserSignedInName         = "user.signed_in"
+	SignInFailedName         = "user.sign_in_failed"
+	TokenRefreshedName       = "token.refreshed"
+	TokenRefreshFailedName   = "token.refresh_failed"
+	SuspiciousIPDetectedName = "security.suspicious_ip"
+	UserLoggedOutName        = "user.logged_out"
+	AccountLockedName        = "security.account_locked"
+	AccountUnlockedName      = "security.account_unlocked"
+	ClientTokenIssuedName    = "client.token_issued"
+	TokenExchangedName       = "token.exchanged"
+	IdentityLinkedName       = "user.identity_linked"
+	PersonalTokenCreatedName = "token.personal_created"
+	PersonalTokenRevokedName = "token.personal_revoked"
+	APIKeyCreatedName        = "api_key.created"
+	APIKeyRevokedName        = "api_key.revoked"
+	EmailChangedName         = "user.email_changed"
+	EmailChangeRequestedName = "user.email_change_requested"
+	AccountDisabledName      = "security.account_disabled"
+	AccountEnabledName       = "security.account_enabled"
+	UserDeletedName          = "user.deleted"
+)
+
+type Event interface {
+	Name() string
+}
+
+type UserSignedUp struct {
+	UserGUID   string
+	Email      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type UserSignedIn struct {
+	UserGUID   string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type SignInFailed struct {
+	UserGUID   string
+	IP         string
+	UserAgent  string
+	Reason     string
+	OccurredAt time.Time
+}
+
+type TokenRefreshed struct {
+	UserGUID   string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type TokenRefreshFailed struct {
+	UserGUID   string
+	IP         string
+	UserAgent  string
+	Reason     string
+	OccurredAt time.Time
+}
+
+type SuspiciousIPDetected struct {
+	UserGUID   string
+	Email      string
+	OldIP      string
+	NewIP      string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type UserLoggedOut struct {
+	UserGUID   string
+	IP         string
+	UserAgent  string
+	Reason     string
+	OccurredAt time.Time
+}
+
+// AccountLocked — refresh сессия пользователя заблокирована после неудачных попыток обновления.
+type AccountLocked struct {
+	UserGUID    string
+	SessionID   string
+	Email       string
+	LockedUntil time.Time
+	IP          string
+	UserAgent   string
+	OccurredAt  time.Time
+}
+
+type AccountUnlocked struct {
+	UserGUID   string
+	AdminGUID  string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type ClientTokenIssued struct {
+	ClientID   string
+	Scope      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type TokenExchanged struct {
+	UserGUID   string
+	ActorGUID  string
+	ClientID   string
+	Audience   string
+	Scope      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type IdentityLinked struct {
+	UserGUID   string
+	Provider   string
+	Subject    string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type PersonalTokenCreated struct {
+	UserGUID   string
+	TokenID    string
+	Scope      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type PersonalTokenRevoked struct {
+	UserGUID   string
+	TokenID    string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type APIKeyCreated struct {
+	AdminGUID  string
+	KeyID      string
+	Scope      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type APIKeyRevoked struct {
+	AdminGUID  string
+	KeyID      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+// EmailChanged публикуется при смене email. ActorGUID — кто изменил: администратор или сам пользователь.
+type EmailChanged struct {
+	UserGUID   string
+	ActorGUID  string
+	OldEmail   string
+	NewEmail   string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+// EmailChangeRequested публикуется, когда пользователь просит сменить email. Кода подтверждения
+// в событии нет: его получает только новый адрес.
+type EmailChangeRequested struct {
+	UserGUID   string
+	OldEmail   string
+	NewEmail   string
+	ExpiresAt  time.Time
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type AccountDisabled struct {
+	UserGUID   string
+	AdminGUID  string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type AccountEnabled struct {
+	UserGUID   string
+	AdminGUID  string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+type UserDeleted struct {
+	UserGUID   string
+	ActorGUID  string
+	Email      string
+	IP         string
+	UserAgent  string
+	OccurredAt time.Time
+}
+
+func (UserSignedUp) Name() string         { return UserSignedUpName }
+func (UserSignedIn) Name() string         { return UserSignedInName }
+func (SignInFailed) Name() string         { return SignInFailedName }
+func (TokenRefreshed) Name() string       { return TokenRefreshedName }
+func (TokenRefreshFailed) Name() string   { return TokenRefreshFailedName }
+func (SuspiciousIPDetected) Name() string { return SuspiciousIPDetectedName }
+func (UserLoggedOut) Name() string        { return UserLoggedOutName }
+func (AccountLocked) Name() string        { return AccountLockedName }
+func (AccountUnlocked) Name() string      { return AccountUnlockedName }
+func (ClientTokenIssued) Name() string    { return ClientTokenIssuedName }
+func (TokenExchanged) Name() string       { return TokenExchangedName }
+func (IdentityLinked) Name() string       { return IdentityLinkedName }
+func (PersonalTokenCreated) Name() string { return PersonalTokenCreatedName }
+func (PersonalTokenRevoked) Name() string { return PersonalTokenRevokedName }
+func (APIKeyCreated) Name() string        { return APIKeyCreatedName }
+func (APIKeyRevoked) Name() string        { return APIKeyRevokedName }
+func (EmailChanged) Name() string         { return EmailChangedName }
+func (EmailChangeRequested) Name() string { return EmailChangeRequestedName }
+func (AccountDisabled) Name() string      { return AccountDisabledName }
+func (AccountEnabled) Name() string       { return AccountEnabledName }
+func (UserDeleted) Name() string          { return UserDeletedName }
@@ -0,0 +1,176 @@
+package request
+
+import "strings"
+
+// Normalizer приводит поля запроса к каноническому виду перед валидацией.
+type Normalizer interface {
+	Normalize()
+}
+
+type SignInRequest struct {
+	GUID     string `json:"guid" query:"guid" validate:"required,uuid"`
+	Delivery string `json:"delivery,omitempty" query:"delivery" validate:"omitempty,oneof=body cookie" enums:"body,cookie"`
+}
+
+type SignUpRequest struct {
+	Email string `json:"email" query:"email" validate:"required,email,max=254"`
+}
+
+func (r *SignUpRequest) Normalize() {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+}
+
+// FieldList — значение параметра fields=guid,email.
+type FieldList string
+
+func (f FieldList) Split() []string {
+	if f == "" {
+		return nil
+	}
+	return strings.Split(string(f), ",")
+}
+
+type PageRequest struct {
+	Page   int       `query:"page" validate:"min=1"`
+	Limit  int       `query:"limit" validate:"min=1,max=100"`
+	Fields FieldList `query:"fields" validate:"omitempty,csvoneof=guid email email_verified role locked_until status created_at"`
+}
+
+type ListUsersRequest struct {
+	Email            string    `query:"email" validate:"omitempty,max=254"`
+	CreatedFrom      string    `query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo        string    `query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	HasActiveSession string    `query:"has_active_session" validate:"omitempty,oneof=true false"`
+	Verified         string    `query:"verified" validate:"omitempty,oneof=true false"`
+	Status           string    `query:"status" validate:"omitempty,oneof=active disabled pending deleted"`
+	Sort             string    `query:"sort" validate:"oneof=created_at -created_at email -email"`
+	Cursor           string    `query:"cursor"`
+	Limit            int       `query:"limit" validate:"min=1,max=100"`
+	IncludeTotal     bool      `query:"include_total"`
+	Fields           FieldList `query:"fields" validate:"omitempty,csvoneof=guid email email_verified role locked_until status created_at"`
+}
+
+type UserGUIDRequest struct {
+	GUID string `param:"guid" validate:"required,uuid"`
+}
+
+type UpdateUserRequest struct {
+	GUID  string `json:"-" param:"guid" validate:"required,uuid"`
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+func (r *UpdateUserRequest) Normalize() {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+}
+
+type LoginRequest struct {
+	GUID     string `form:"guid" validate:"required,uuid"`
+	ReturnTo string `form:"return_to"`
+}
+
+func (r *LoginRequest) Normalize() {
+	r.GUID = strings.TrimSpace(r.GUID)
+}
+
+type EmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+func (r *EmailChangeRequest) Normalize() {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+}
+
+type EmailConfirmRequest struct {
+	Code string `json:"code" validate:"required,max=64"`
+}
+
+type ActivityRequest struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"min=1,max=100"`
+}
+
+type AuditEventsRequest struct {
+	UserGUID  string `query:"user_guid" validate:"omitempty,uuid"`
+	EventType string `query:"event_type" validate:"omitempty,max=64"`
+	From      string `query:"from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To        string `query:"to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Cursor    string `query:"cursor"`
+	Limit     int    `query:"limit" validate:"min=1,max=500"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `query:"response_type"`
+	ClientID            string `query:"client_id"`
+	RedirectURI         string `query:"redirect_uri"`
+	Scope               string `query:"scope"`
+	State               string `query:"state"`
+	CodeChallenge       string `query:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method"`
+	Nonce               string `query:"nonce"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	Scope        string `form:"scope"`
+	DeviceCode   string `form:"device_code"`
+
+	SubjectToken       string `form:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"`
+	ActorToken         string `form:"actor_token"`
+	ActorTokenType     string `form:"actor_token_type"`
+	Audience           string `form:"audience"`
+	RequestedTokenType string `form:"requested_token_type"`
+}
+
+type OAuthClientRequest struct {
+	Name                   string   `json:"name" validate:"required,max=100"`
+	Confidential           bool     `json:"confidential"`
+	RedirectURIs           []string `json:"redirect_uris" validate:"dive,required,url"`
+	GrantTypes             []string `json:"grant_types"`
+	Scopes                 []string `json:"scopes"`
+	Audiences              []string `json:"audiences"`
+	AccessTokenTTL         int      `json:"access_token_ttl" validate:"min=0"`
+	TLSClientAuthSubjectDN string   `json:"tls_client_auth_subject_dn"`
+}
+
+type EndSessionRequest struct {
+	IDTokenHint           string `query:"id_token_hint"`
+	ClientID              string `query:"client_id"`
+	PostLogoutRedirectURI string `query:"post_logout_redirect_uri"`
+	State                 string `query:"state"`
+}
+
+type DeviceAuthorizationRequest struct {
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+}
+
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" form:"user_code" validate:"required"`
+	Approve  bool   `json:"approve" form:"approve"`
+}
+
+type PersonalAccessTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0"`
+}
+
+type APIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes"`
+	AllowedIPs    []string `json:"allowed_ips" validate:"dive,ip|cidr"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0"`
+}
+
+type RefreshRequest struct {
+	GrantType    string `json:"-" form:"grant_type"`
+	AccessToken  string `json:"access_token" form:"access_token"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
@@ -0,0 +1,58 @@
+package response
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// UserResponse — представление пользователя для API. Секреты (хеш refresh token, привязки токенов)
+// в него не попадают.
+type UserResponse struct {
+	GUID          uuid.UUID `json:"guid"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	fields []string
+}
+
+func NewUserResponse(user domain.User) UserResponse {
+	return UserResponse{
+		GUID:          user.GUID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Status:        user.Status,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+// Select ограничивает сериализацию перечисленными полями, пустой список оставляет все поля.
+func (u UserResponse) Select(fields []string) UserResponse {
+	u.fields = fields
+	return u
+}
+
+func (u UserResponse) MarshalJSON() ([]byte, error) {
+	type plain UserResponse
+	data, err := json.Marshal(plain(u))
+	if err != nil || len(u.fields) == 0 {
+		return data, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(u.fields))
+	for _, field := range u.fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return json.Marshal(selected)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+type APIKeyRepositoryInterface interface {
+	Insert(key *domain.APIKey) error
+	FindByPrefix(prefix string) (*domain.APIKey, error)
+	GetAll() ([]domain.APIKey, error)
+	Revoke(id uuid.UUID, now time.Time) (bool, error)
+	RecordUsage(id uuid.UUID, ip string, now time.Time) error
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (repo *APIKeyRepository) Insert(key *domain.APIKey) error {
+	return repo.db.Create(key).Error
+}
+
+func (repo *APIKeyRepository) FindByPrefix(prefix string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	if err := repo.db.First(&key, "prefix = ?", prefix).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (repo *APIKeyRepository) GetAll() ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	err := repo.db.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (repo *APIKeyRepository) Revoke(id uuid.UUID, now time.Time) (bool, error) {
+	result := repo.db.Model(&domain.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", now)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (repo *APIKeyRepository) RecordUsage(id uuid.UUID, ip string, now time.Time) error {
+	return repo.db.Model(&domain.APIKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"usage_count":  gorm.Expr("usage_count + 1"),
+		"last_used_at": now,
+		"last_used_ip": ip,
+	}).Error
+}
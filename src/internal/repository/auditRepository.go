@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Произвольный ключ advisory lock, сериализующий добавление записей в цепочку аудита.
+const auditChainLockKey = 2814749767
+
+type AuditFilter struct {
+	UserGUID  *uuid.UUID
+	EventType string
+	From      *time.Time
+	To        *time.Time
+}
+
+type AuditCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+type AuditRepositoryInterface interface {
+	Append(event *domain.AuditEvent) error
+	Find(filter AuditFilter, after *AuditCursor, limit int) ([]domain.AuditEvent, error)
+	FindBySeqRange(afterSeq int64, limit int) ([]domain.AuditEvent, error)
+	FindBySeq(seq int64) (*domain.AuditEvent, error)
+	Last() (*domain.AuditEvent, error)
+	InsertCheckpoint(checkpoint *domain.AuditCheckpoint) error
+	LastCheckpoint() (*domain.AuditCheckpoint, error)
+	GetCheckpoints() ([]domain.AuditCheckpoint, error)
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (repo *AuditRepository) Append(event *domain.AuditEvent) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+			return err
+		}
+
+		var last domain.AuditEvent
+		err := tx.Order("seq DESC").First(&last).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			event.Seq = 1
+			event.PrevHash = strings.Repeat("0", 64)
+		case err != nil:
+			return err
+		default:
+			event.Seq = last.Seq + 1
+			event.PrevHash = last.Hash
+		}
+
+		// Postgres хранит timestamp с точностью до микросекунд, хеш должен совпадать с тем, что прочитаем обратно.
+		event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+		event.Hash = event.ComputeHash()
+		return tx.Create(event).Error
+	})
+}
+
+func (repo *AuditRepository) Find(filter AuditFilter, after *AuditCursor, limit int) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+
+	query := repo.db.Model(&domain.AuditEvent{})
+	if filter.UserGUID != nil {
+		query = query.Where("user_guid = ?", *filter.UserGUID)
+	}
+	if filter.EventType != "" {
+		query = query.Where("event_type = ?", filter.EventType)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if after != nil {
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (repo *AuditRepository) FindBySeqRange(afterSeq int64, limit int) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	err := repo.db.Where("seq > ?", afterSeq).Order("seq ASC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (repo *AuditRepository) FindBySeq(seq int64) (*domain.AuditEvent, error) {
+	var event domain.AuditEvent
+	if err := repo.db.First(&event, "seq = ?", seq).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (repo *AuditRepository) Last() (*domain.AuditEvent, error) {
+	var event domain.AuditEvent
+	if err := repo.db.Order("seq DESC").First(&event).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (repo *AuditRepository) InsertCheckpoint(checkpoint *domain.AuditCheckpoint) error {
+	return repo.db.Create(checkpoint).Error
+}
+
+func (repo *AuditRepository) LastCheckpoint() (*domain.AuditCheckpoint, error) {
+	var checkpoint domain.AuditCheckpoint
+	if err := repo.db.Order("seq DESC").First(&checkpoint).Error; err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (repo *AuditRepository) GetCheckpoints() ([]domain.AuditCheckpoint, error) {
+	var checkpoints []domain.AuditCheckpoint
+	err := repo.db.Order("seq ASC").Find(&checkpoints).Error
+	return checkpoints, err
+}
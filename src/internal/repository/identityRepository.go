@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"gorm.io/gorm"
+)
+
+type IdentityRepository struct {
+	db *gorm.DB
+}
+
+type IdentityRepositoryInterface interface {
+	Find(provider, subject string) (*domain.ExternalIdentity, error)
+	Insert(identity *domain.ExternalIdentity) error
+}
+
+func NewIdentityRepository(db *gorm.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+func (repo *IdentityRepository) Find(provider, subject string) (*domain.ExternalIdentity, error) {
+	var identity domain.ExternalIdentity
+	if err := repo.db.First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (repo *IdentityRepository) Insert(identity *domain.ExternalIdentity) error {
+	return repo.db.Create(identity).Error
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"gorm.io/gorm"
+	"time"
+)
+
+type OAuthRepository struct {
+	db *gorm.DB
+}
+
+type OAuthRepositoryInterface interface {
+	InsertClient(client *domain.OAuthClient) error
+	FindClient(clientID string) (*domain.OAuthClient, error)
+	InsertCode(code *domain.AuthorizationCode) error
+	FindCode(codeHash string) (*domain.AuthorizationCode, error)
+	MarkCodeUsed(codeHash string, usedAt time.Time) (bool, error)
+	InsertDeviceCode(code *domain.DeviceCode) error
+	FindDeviceCode(deviceCodeHash string) (*domain.DeviceCode, error)
+	FindDeviceCodeByUserCode(userCode string) (*domain.DeviceCode, error)
+	UpdateDeviceCode(code *domain.DeviceCode) error
+	ConsumeDeviceCode(deviceCodeHash string) (bool, error)
+}
+
+func NewOAuthRepository(db *gorm.DB) *OAuthRepository {
+	return &OAuthRepository{db: db}
+}
+
+func (repo *OAuthRepository) InsertClient(client *domain.OAuthClient) error {
+	return repo.db.Create(client).Error
+}
+
+func (repo *OAuthRepository) FindClient(clientID string) (*domain.OAuthClient, error) {
+	var client domain.OAuthClient
+	if err := repo.db.First(&client, "client_id = ?", clientID).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (repo *OAuthRepository) InsertCode(code *domain.AuthorizationCode) error {
+	return repo.db.Create(code).Error
+}
+
+func (repo *OAuthRepository) FindCode(codeHash string) (*domain.AuthorizationCode, error) {
+	var code domain.AuthorizationCode
+	if err := repo.db.First(&code, "code_hash = ?", codeHash).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// MarkCodeUsed атомарно помечает код использованным. false означает, что код уже был обменян.
+func (repo *OAuthRepository) MarkCodeUsed(codeHash string, usedAt time.Time) (bool, error) {
+	result := repo.db.Model(&domain.AuthorizationCode{}).
+		Where("code_hash = ? AND used_at IS NULL", codeHash).
+		Update("used_at", usedAt)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (repo *OAuthRepository) InsertDeviceCode(code *domain.DeviceCode) error {
+	return repo.db.Create(code).Error
+}
+
+func (repo *OAuthRepository) FindDeviceCode(deviceCodeHash string) (*domain.DeviceCode, error) {
+	var code domain.DeviceCode
+	if err := repo.db.First(&code, "device_code_hash = ?", deviceCodeHash).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (repo *OAuthRepository) FindDeviceCodeByUserCode(userCode string) (*domain.DeviceCode, error) {
+	var code domain.DeviceCode
+	if err := repo.db.First(&code, "user_code = ?", userCode).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (repo *OAuthRepository) UpdateDeviceCode(code *domain.DeviceCode) error {
+	return repo.db.Save(code).Error
+}
+
+// ConsumeDeviceCode атомарно переводит одобренный код в consumed, чтобы токены по нему выдавались один раз.
+func (repo *OAuthRepository) ConsumeDeviceCode(deviceCodeHash string) (bool, error) {
+	result := repo.db.Model(&domain.DeviceCode{}).
+		Where("device_code_hash = ? AND status = ?", deviceCodeHash, domain.DeviceCodeApproved).
+		Update("status", domain.DeviceCodeConsumed)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+type SessionRepositoryInterface interface {
+	Insert(session *domain.RefreshSession) error
+	Find(id uuid.UUID) (*domain.RefreshSession, error)
+	Rotate(id uuid.UUID, oldHash, newHash, jkt, x5t string) (bool, error)
+	UpdateLockout(session *domain.RefreshSession) error
+	UnlockByUser(userGUID uuid.UUID) (int64, error)
+	Delete(id uuid.UUID) (bool, error)
+	DeleteByUser(userGUID uuid.UUID) (int64, error)
+	DeleteByClient(userGUID uuid.UUID, clientID string) (int64, error)
+	DeleteByAuthCode(codeHash string) (int64, error)
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (repo *SessionRepository) Insert(session *domain.RefreshSession) error {
+	return repo.db.Create(session).Error
+}
+
+func (repo *SessionRepository) Find(id uuid.UUID) (*domain.RefreshSession, error) {
+	var session domain.RefreshSession
+	if err := repo.db.First(&session, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Rotate заменяет хеш refresh token, только если он не менялся с момента чтения: из двух одновременных
+// обновлений одним токеном успешно только одно. Успешное обновление сбрасывает счётчик неудачных попыток.
+func (repo *SessionRepository) Rotate(id uuid.UUID, oldHash, newHash, jkt, x5t string) (bool, error) {
+	result := repo.db.Model(&domain.RefreshSession{}).
+		Where("id = ? AND token_hash = ?", id, oldHash).
+		Updates(map[string]interface{}{"token_hash": newHash, "jkt": jkt, "x5t": x5t, "failed_attempts": 0})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (repo *SessionRepository) UpdateLockout(session *domain.RefreshSession) error {
+	return repo.db.Model(&domain.RefreshSession{}).Where("id = ?", session.ID).
+		Updates(map[string]interface{}{
+			"failed_attempts": session.FailedAttempts,
+			"lockout_count":   session.LockoutCount,
+			"locked_until":    session.LockedUntil,
+		}).Error
+}
+
+func (repo *SessionRepository) UnlockByUser(userGUID uuid.UUID) (int64, error) {
+	result := repo.db.Model(&domain.RefreshSession{}).Where("user_guid = ?", userGUID).
+		Updates(map[string]interface{}{"failed_attempts": 0, "lockout_count": 0, "locked_until": nil})
+	return result.RowsAffected, result.Error
+}
+
+func (repo *SessionRepository) Delete(id uuid.UUID) (bool, error) {
+	result := repo.db.Delete(&domain.RefreshSession{}, "id = ?", id)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (repo *SessionRepository) DeleteByUser(userGUID uuid.UUID) (int64, error) {
+	result := repo.db.Delete(&domain.RefreshSession{}, "user_guid = ?", userGUID)
+	return result.RowsAffected, result.Error
+}
+
+func (repo *SessionRepository) DeleteByClient(userGUID uuid.UUID, clientID string) (int64, error) {
+	result := repo.db.Delete(&domain.RefreshSession{}, "user_guid = ? AND client_id = ?", userGUID, clientID)
+	return result.RowsAffected, result.Error
+}
+
+func (repo *SessionRepository) DeleteByAuthCode(codeHash string) (int64, error) {
+	result := repo.db.Delete(&domain.RefreshSession{}, "auth_code_hash = ?", codeHash)
+	return result.RowsAffected, result.Error
+}
+
+func (repo *SessionRepository) DeleteExpired(now time.Time) (int64, error) {
+	result := repo.db.Delete(&domain.RefreshSession{}, "expires_at <= ?", now)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type TokenRepository struct {
+	db *gorm.DB
+}
+
+type TokenRepositoryInterface interface {
+	Insert(token *domain.PersonalAccessToken) error
+	FindByHash(tokenHash string) (*domain.PersonalAccessToken, error)
+	FindByUser(userGUID uuid.UUID) ([]domain.PersonalAccessToken, error)
+	Revoke(id, userGUID uuid.UUID, now time.Time) (bool, error)
+	TouchLastUsed(id uuid.UUID, now time.Time, interval time.Duration) error
+}
+
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+func (repo *TokenRepository) Insert(token *domain.PersonalAccessToken) error {
+	return repo.db.Create(token).Error
+}
+
+func (repo *TokenRepository) FindByHash(tokenHash string) (*domain.PersonalAccessToken, error) {
+	var token domain.PersonalAccessToken
+	if err := repo.db.First(&token, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repo *TokenRepository) FindByUser(userGUID uuid.UUID) ([]domain.PersonalAccessToken, error) {
+	var tokens []domain.PersonalAccessToken
+	err := repo.db.Where("user_guid = ?", userGUID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (repo *TokenRepository) Revoke(id, userGUID uuid.UUID, now time.Time) (bool, error) {
+	result := repo.db.Model(&domain.PersonalAccessToken{}).
+		Where("id = ? AND user_guid = ? AND revoked_at IS NULL", id, userGUID).
+		Update("revoked_at", now)
+	return result.RowsAffected == 1, result.Error
+}
+
+// TouchLastUsed обновляет last_used_at не чаще раза в interval, чтобы не писать в базу на каждый запрос.
+func (repo *TokenRepository) TouchLastUsed(id uuid.UUID, now time.Time, interval time.Duration) error {
+	return repo.db.Model(&domain.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-interval)).
+		Update("last_used_at", now).Error
+}
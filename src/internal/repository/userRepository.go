@@ -2,9 +2,45 @@ package repository
 
 import (
 	"JwtTestTask/src/internal/domain"
+	"fmt"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"strings"
+	"time"
 )
 
+// UserFilter без Status исключает мягко удалённых пользователей, Status=deleted выбирает только их.
+type UserFilter struct {
+	Status           string
+	EmailContains    string
+	CreatedFrom      *time.Time
+	CreatedTo        *time.Time
+	HasActiveSession *bool
+	Verified         *bool
+}
+
+// UserSort — ключ сортировки списка, поле из userSortColumns.
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// UserCursor указывает на последнего пользователя страницы: значение поля сортировки и GUID для однозначности.
+type UserCursor struct {
+	Value string
+	GUID  uuid.UUID
+}
+
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortEmail     = "email"
+)
+
+var userSortColumns = map[string]string{
+	UserSortCreatedAt: "created_at",
+	UserSortEmail:     "email",
+}
+
 type UserRepository struct {
 	db *gorm.DB
 }
@@ -12,15 +48,66 @@ type UserRepository struct {
 type UserRepositoryInterface interface {
 	FindByGUID(guid string) (*domain.User, error)
 	InsertUser(user domain.User) error
-	UpdateUser(user *domain.User) error
 	FindByEmail(email string) (*domain.User, error)
 	GetAll(page, limit int) ([]domain.User, int64, error)
+	Find(filter UserFilter, sort UserSort, after *UserCursor, limit int) ([]domain.User, error)
+	Count(filter UserFilter) (int64, error)
+	UpdateEmail(guid uuid.UUID, email string) error
+	SetPendingEmail(guid uuid.UUID, email, tokenHash string, expiry time.Time) error
+	ConfirmEmail(guid uuid.UUID, email string) error
+	SetStatus(guid uuid.UUID, status string) error
+	DeleteUser(guid uuid.UUID) error
+	PurgeDeleted(before time.Time) (int64, error)
 }
 
 func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// legacyUserColumns — колонки прежней схемы, которых больше нет в модели. Refresh token в users не
+// переносятся в refresh_sessions: у выданных с ними access token нет sid, пользователи входят заново.
+// Счётчики блокировки теперь ведутся по refresh сессиям и тоже не переносятся.
+var legacyUserColumns = []string{
+	"refresh_token", "refresh_token_expiry", "refresh_token_jkt", "refresh_token_x5t",
+	"failed_attempts", "lockout_count", "locked_until",
+}
+
+// legacyEmailConstraints — прежние ограничения уникальности email на всю таблицу, включая удалённых.
+// Их заменяет частичный индекс idx_users_email_active. Имя зависит от версии GORM, создавшей таблицу.
+var legacyEmailConstraints = []string{"uni_users_email", "users_email_key"}
+
+// MigrateLegacyColumns переносит флаг disabled из прежней схемы в status и удаляет устаревшие колонки
+// и ограничения. AutoMigrate их не удаляет, поэтому без переноса отключённые пользователи стали бы активными.
+func (repo *UserRepository) MigrateLegacyColumns() error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		for _, constraint := range legacyEmailConstraints {
+			if err := tx.Exec("ALTER TABLE users DROP CONSTRAINT IF EXISTS " + constraint).Error; err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasColumn(&domain.User{}, "disabled") {
+			err := tx.Unscoped().Model(&domain.User{}).
+				Where("disabled = ? AND status = ?", true, domain.UserStatusActive).
+				Update("status", domain.UserStatusDisabled).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&domain.User{}, "disabled"); err != nil {
+				return err
+			}
+		}
+		for _, column := range legacyUserColumns {
+			if !tx.Migrator().HasColumn(&domain.User{}, column) {
+				continue
+			}
+			if err := tx.Migrator().DropColumn(&domain.User{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (repo *UserRepository) FindByGUID(guid string) (*domain.User, error) {
 	var user domain.User
 	if err := repo.db.First(&user, "guid = ?", guid).Error; err != nil {
@@ -30,11 +117,7 @@ func (repo *UserRepository) FindByGUID(guid string) (*domain.User, error) {
 }
 
 func (repo *UserRepository) InsertUser(user domain.User) error {
-	return repo.db.Create(user).Error
-}
-
-func (repo *UserRepository) UpdateUser(user *domain.User) error {
-	return repo.db.Save(user).Error
+	return repo.db.Create(&user).Error
 }
 
 func (repo *UserRepository) FindByEmail(email string) (*domain.User, error) {
@@ -56,3 +139,162 @@ func (repo *UserRepository) GetAll(page, limit int) ([]domain.User, int64, error
 
 	return users, total, query.Error
 }
+
+// Пользователи меняются только точечными UPDATE с условием в WHERE, а не Save: Save, не нашедший строку,
+// выполняет INSERT ... ON CONFLICT DO UPDATE и восстановил бы пользователя, удалённого между чтением
+// и записью. Soft delete добавляет к таким запросам deleted_at IS NULL, ни одной обновлённой строки —
+// gorm.ErrRecordNotFound.
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateEmail сбрасывает подтверждение: новый адрес ещё не подтверждён.
+func (repo *UserRepository) UpdateEmail(guid uuid.UUID, email string) error {
+	return affected(repo.db.Model(&domain.User{}).Where("guid = ?", guid).
+		Updates(map[string]interface{}{"email": email, "email_verified": false}))
+}
+
+// SetPendingEmail запоминает запрошенную смену email, только пока учётная запись активна.
+func (repo *UserRepository) SetPendingEmail(guid uuid.UUID, email, tokenHash string, expiry time.Time) error {
+	return affected(repo.db.Model(&domain.User{}).Where("guid = ? AND status = ?", guid, domain.UserStatusActive).
+		Updates(map[string]interface{}{
+			"pending_email":           email,
+			"email_change_token_hash": tokenHash,
+			"email_change_expiry":     expiry,
+		}))
+}
+
+// ConfirmEmail применяет подтверждённую смену email: адрес считается подтверждённым, запрос на смену сбрасывается.
+// Как и SetPendingEmail, срабатывает только для активной учётной записи.
+func (repo *UserRepository) ConfirmEmail(guid uuid.UUID, email string) error {
+	return affected(repo.db.Model(&domain.User{}).Where("guid = ? AND status = ?", guid, domain.UserStatusActive).
+		Updates(map[string]interface{}{
+			"email":                   email,
+			"email_verified":          true,
+			"pending_email":           "",
+			"email_change_token_hash": "",
+			"email_change_expiry":     nil,
+		}))
+}
+
+// SetStatus при переводе в неактивный статус сразу отзывает refresh сессии.
+func (repo *UserRepository) SetStatus(guid uuid.UUID, status string) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := affected(tx.Model(&domain.User{}).Where("guid = ?", guid).Update("status", status)); err != nil {
+			return err
+		}
+		if status == domain.UserStatusActive {
+			return nil
+		}
+		return tx.Delete(&domain.RefreshSession{}, "user_guid = ?", guid).Error
+	})
+}
+
+// DeleteUser мягко удаляет пользователя: статус deleted, refresh сессии отозваны, deleted_at выставлен.
+// Строка и связанные данные остаются до PurgeDeleted.
+func (repo *UserRepository) DeleteUser(guid uuid.UUID) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.User{}).Where("guid = ?", guid).Update("status", domain.UserStatusDeleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&domain.RefreshSession{}, "user_guid = ?", guid).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.User{}, "guid = ?", guid).Error
+	})
+}
+
+// PurgeDeleted окончательно удаляет пользователей, мягко удалённых раньше before, вместе с их
+// personal access tokens и внешними учётными записями. Записи аудита остаются: они нужны для расследований.
+func (repo *UserRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	err := repo.db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&domain.User{}).Select("guid").Where("deleted_at < ?", before)
+		if err := tx.Where("user_guid IN (?)", expired).Delete(&domain.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_guid IN (?)", expired).Delete(&domain.ExternalIdentity{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", before).Delete(&domain.User{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+func (repo *UserRepository) Find(filter UserFilter, sort UserSort, after *UserCursor, limit int) ([]domain.User, error) {
+	var users []domain.User
+
+	column, ok := userSortColumns[sort.Field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field: %s", sort.Field)
+	}
+	direction, comparison := "ASC", ">"
+	if sort.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := repo.filtered(filter)
+	if after != nil {
+		var value interface{} = after.Value
+		if sort.Field == UserSortCreatedAt {
+			createdAt, err := time.Parse(time.RFC3339Nano, after.Value)
+			if err != nil {
+				return nil, err
+			}
+			value = createdAt
+		}
+		query = query.Where(fmt.Sprintf("(%s, guid) %s (?, ?)", column, comparison), value, after.GUID)
+	}
+
+	err := query.Order(fmt.Sprintf("%s %s, guid %s", column, direction, direction)).Limit(limit).Find(&users).Error
+	return users, err
+}
+
+func (repo *UserRepository) Count(filter UserFilter) (int64, error) {
+	var total int64
+	err := repo.filtered(filter).Count(&total).Error
+	return total, err
+}
+
+func (repo *UserRepository) filtered(filter UserFilter) *gorm.DB {
+	query := repo.db.Model(&domain.User{})
+	if filter.Status == domain.UserStatusDeleted {
+		query = query.Unscoped()
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.EmailContains != "" {
+		query = query.Where("email ILIKE ?", "%"+likeEscaper.Replace(filter.EmailContains)+"%")
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+	if filter.HasActiveSession != nil {
+		activeSessions := repo.db.Model(&domain.RefreshSession{}).Select("1").
+			Where("refresh_sessions.user_guid = users.guid AND refresh_sessions.expires_at > ?", time.Now())
+		if *filter.HasActiveSession {
+			query = query.Where("EXISTS (?)", activeSessions)
+		} else {
+			query = query.Where("NOT EXISTS (?)", activeSessions)
+		}
+	}
+	if filter.Verified != nil {
+		query = query.Where("email_verified = ?", *filter.Verified)
+	}
+	return query
+}
+
+// likeEscaper экранирует спецсимволы LIKE, чтобы подстрока email искалась буквально.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
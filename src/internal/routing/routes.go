@@ -2,15 +2,128 @@ package routing
 
 import (
 	"JwtTestTask/src/internal/delivery/http"
+	"JwtTestTask/src/internal/domain"
 	"JwtTestTask/src/internal/service"
+	"JwtTestTask/src/internal/subscriber"
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/config"
+	"JwtTestTask/src/pkg/dpop"
+	"JwtTestTask/src/pkg/ratelimit"
 	"github.com/labstack/echo/v4"
 )
 
-func SetupUserRoute(e *echo.Echo, userService *service.UserService) {
-	userHandler := http.NewUserHandler(userService)
+func SetupErrorHandler(e *echo.Echo) {
+	e.HTTPErrorHandler = http.ErrorHandler
+}
+
+func SetupValidator(e *echo.Echo) {
+	e.Validator = http.NewRequestValidator()
+}
+
+func SetupDPoPMiddleware(e *echo.Echo, proofs dpop.VerifierInterface) {
+	e.Use(http.DPoPMiddleware(proofs))
+}
+
+func SetupUserRoute(e *echo.Echo, userService *service.UserService, limitStore ratelimit.Store, limits config.RateLimitParams, cookies config.CookieParams, transport config.TokenTransportParams, legacy config.LegacyRoutesParams, authenticator auth.TokenParserInterface) {
+	userHandler := http.NewUserHandler(userService, cookies, transport)
+
+	v1 := e.Group("/api/v1")
+	v1.POST("/users", userHandler.CreateUser, http.RateLimitMiddleware(limitStore, limits, http.RateLimitSignUp, http.AccountFromBody("email")))
+	v1.GET("/users", userHandler.ListUsers, http.AuthMiddleware(authenticator), http.RequireUserToken(), http.RequireRole(domain.RoleAdmin))
+	v1.POST("/sessions", userHandler.CreateSession, http.RateLimitMiddleware(limitStore, limits, http.RateLimitSignIn, http.AccountFromBody("guid")))
+	v1.POST("/tokens", userHandler.RefreshSession, http.RateLimitMiddleware(limitStore, limits, http.RateLimitRefresh, http.AccountFromAccessToken()))
+
+	if !legacy.Enabled {
+		return
+	}
+	e.POST("/signIn", userHandler.UserSignIn, http.DeprecationMiddleware(legacy, "/api/v1/sessions"), http.RateLimitMiddleware(limitStore, limits, http.RateLimitSignIn, http.AccountFromQuery("guid")))
+	e.POST("/signUp", userHandler.UserSignUp, http.DeprecationMiddleware(legacy, "/api/v1/users"), http.RateLimitMiddleware(limitStore, limits, http.RateLimitSignUp, http.AccountFromQuery("email")))
+	e.POST("/refresh", userHandler.RefreshTokens, http.DeprecationMiddleware(legacy, "/api/v1/tokens"), http.RateLimitMiddleware(limitStore, limits, http.RateLimitRefresh, http.AccountFromAccessToken()))
+	e.GET("/getAll", userHandler.GetAll, http.DeprecationMiddleware(legacy, "/api/v1/users"), http.AuthMiddleware(authenticator), http.RequireUserToken(), http.RequireRole(domain.RoleAdmin))
+}
+
+// SetupMeRoute принимает только access token: PAT и API ключи не дают доступа к управлению учётной записью.
+func SetupMeRoute(e *echo.Echo, userService *service.UserService, auditService *service.AuditService, limitStore ratelimit.Store, limits config.RateLimitParams, jwtManager auth.JwtManagerInterface) {
+	meHandler := http.NewMeHandler(userService, auditService)
+
+	me := e.Group("/api/v1/me", http.AuthMiddleware(jwtManager))
+	me.GET("", meHandler.GetProfile)
+	me.DELETE("", meHandler.DeleteAccount)
+	me.POST("/email", meHandler.ChangeEmail, http.RateLimitMiddleware(limitStore, limits, http.RateLimitEmailChange, http.AccountFromAccessToken()))
+	me.POST("/email/confirm", meHandler.ConfirmEmail, http.RateLimitMiddleware(limitStore, limits, http.RateLimitEmailConfirm, http.AccountFromAccessToken()))
+	me.GET("/activity", meHandler.GetActivity)
+}
+
+// SetupMetricsRoute открывает счётчики событий только администраторам: по ним видно, сколько входов,
+// блокировок и смен IP происходит. Сборщик метрик авторизуется API ключом администратора.
+func SetupMetricsRoute(e *echo.Echo, metrics *subscriber.Metrics, authenticator auth.TokenParserInterface) {
+	metricsHandler := http.NewMetricsHandler(metrics)
+
+	e.GET("/metrics", metricsHandler.GetMetrics, http.AuthMiddleware(authenticator), http.RequireUserToken(), http.RequireRole(domain.RoleAdmin))
+}
+
+func SetupAdminRoute(e *echo.Echo, userService *service.UserService, auditService *service.AuditService, apiKeyService *service.APIKeyService, authenticator auth.TokenParserInterface) {
+	adminHandler := http.NewAdminHandler(userService)
+	auditHandler := http.NewAuditHandler(auditService)
+	apiKeyHandler := http.NewAPIKeyHandler(apiKeyService)
+
+	admin := e.Group("/admin", http.AuthMiddleware(authenticator), http.RequireUserToken(), http.RequireRole(domain.RoleAdmin))
+	admin.GET("/audit-events", auditHandler.GetEvents)
+	admin.GET("/users/:guid", adminHandler.GetUser)
+	admin.PATCH("/users/:guid", adminHandler.UpdateUser)
+	admin.DELETE("/users/:guid", adminHandler.DeleteUser)
+	admin.POST("/users/:guid/unlock", adminHandler.UnlockUser)
+	admin.POST("/users/:guid/disable", adminHandler.DisableUser)
+	admin.POST("/users/:guid/enable", adminHandler.EnableUser)
+	admin.POST("/users/:guid/logout", adminHandler.LogoutUser)
+	admin.POST("/api-keys", apiKeyHandler.CreateKey)
+	admin.GET("/api-keys", apiKeyHandler.ListKeys)
+	admin.DELETE("/api-keys/:id", apiKeyHandler.RevokeKey)
+}
+
+// SetupLoginRoute — вход в браузере, после которого работают /authorize и страница подтверждения устройства.
+func SetupLoginRoute(e *echo.Echo, userService *service.UserService, limitStore ratelimit.Store, limits config.RateLimitParams, cookies config.CookieParams) {
+	loginHandler := http.NewLoginHandler(userService, cookies)
+
+	e.GET("/login", loginHandler.LoginPage)
+	e.POST("/login", loginHandler.Login, http.RateLimitMiddleware(limitStore, limits, http.RateLimitSignIn, http.AccountFromForm("guid")))
+}
+
+func SetupOAuthRoute(e *echo.Echo, oauthService *service.OAuthService, jwtManager auth.JwtManagerInterface, cookies config.CookieParams) {
+	oauthHandler := http.NewOAuthHandler(oauthService, cookies)
+
+	e.GET("/authorize", oauthHandler.Authorize, http.BrowserAuthMiddleware(jwtManager), http.RequireUserToken())
+	e.POST("/token", oauthHandler.Token)
+	e.POST("/device_authorization", oauthHandler.DeviceAuthorization)
+	e.GET("/device", oauthHandler.DevicePage, http.BrowserAuthMiddleware(jwtManager), http.RequireUserToken())
+	e.POST("/device", oauthHandler.ConfirmDevice, http.BrowserAuthMiddleware(jwtManager), http.RequireUserToken())
+	e.POST("/device/verify", oauthHandler.VerifyDevice, http.AuthMiddleware(jwtManager), http.RequireUserToken())
+	e.POST("/admin/oauth/clients", oauthHandler.RegisterClient, http.AuthMiddleware(jwtManager), http.RequireUserToken(), http.RequireRole(domain.RoleAdmin))
+}
+
+func SetupOIDCRoute(e *echo.Echo, oidcService *service.OIDCService, authenticator auth.TokenParserInterface, cookies config.CookieParams) {
+	oidcHandler := http.NewOIDCHandler(oidcService, cookies)
+
+	e.GET("/.well-known/openid-configuration", oidcHandler.Discovery)
+	e.GET("/.well-known/jwks.json", oidcHandler.JWKS)
+	e.GET("/userinfo", oidcHandler.UserInfo, http.AuthMiddleware(authenticator))
+	e.POST("/userinfo", oidcHandler.UserInfo, http.AuthMiddleware(authenticator))
+	e.GET("/logout", oidcHandler.EndSession)
+}
+
+func SetupSSORoute(e *echo.Echo, ssoService *service.SSOService, authenticator auth.TokenParserInterface, cookies config.CookieParams) {
+	ssoHandler := http.NewSSOHandler(ssoService, cookies)
+
+	e.GET("/sso/:provider/login", ssoHandler.Login)
+	e.GET("/sso/:provider/link", ssoHandler.Link, http.BrowserAuthMiddleware(authenticator), http.RequireUserToken())
+	e.GET("/sso/:provider/callback", ssoHandler.Callback)
+}
+
+func SetupTokenRoute(e *echo.Echo, tokenService *service.TokenService, authenticator auth.TokenParserInterface) {
+	tokenHandler := http.NewTokenHandler(tokenService)
 
-	e.POST("/signIn", userHandler.UserSignIn)
-	e.POST("/signUp", userHandler.UserSignUp)
-	e.POST("/refresh", userHandler.RefreshTokens)
-	e.GET("/getAll", userHandler.GetAll)
+	tokens := e.Group("/personal-tokens", http.AuthMiddleware(authenticator), http.RequireUserToken())
+	tokens.POST("", tokenHandler.CreateToken)
+	tokens.GET("", tokenHandler.ListTokens)
+	tokens.DELETE("/:id", tokenHandler.RevokeToken)
 }
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"net"
+	"strings"
+	"time"
+)
+
+// APIKeyClientID записывается в claims запросов, аутентифицированных API ключом.
+const APIKeyClientID = "api_key"
+
+var apiKeyScopes = map[string]bool{
+	ScopeAdmin: true,
+}
+
+type APIKeyService struct {
+	repo repository.APIKeyRepositoryInterface
+	bus  event.BusInterface
+}
+
+type APIKeyServiceInterface interface {
+	Create(claims *auth.CustomClaims, req request.APIKeyRequest, client domain.ClientInfo) (response.APIKeyResponse, error)
+	GetAll(claims *auth.CustomClaims) ([]domain.APIKey, error)
+	Revoke(claims *auth.CustomClaims, id string, client domain.ClientInfo) error
+	Authenticate(key, ip string) (*auth.CustomClaims, error)
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepositoryInterface, bus event.BusInterface) *APIKeyService {
+	return &APIKeyService{repo: repo, bus: bus}
+}
+
+// Create выпускает ключ интеграции. Ключ не привязан к пользователю и возвращается только
+// в ответе, в базе хранятся prefix и sha256 хеш секрета.
+func (s *APIKeyService) Create(claims *auth.CustomClaims, req request.APIKeyRequest, client domain.ClientInfo) (response.APIKeyResponse, error) {
+	adminGUID, err := keyManager(claims)
+	if err != nil {
+		return response.APIKeyResponse{}, err
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return response.APIKeyResponse{}, invalidRequest("name is required")
+	}
+	for _, scope := range req.Scopes {
+		if !apiKeyScopes[scope] {
+			return response.APIKeyResponse{}, invalidRequest("unsupported scope: " + scope)
+		}
+	}
+	for _, entry := range req.AllowedIPs {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return response.APIKeyResponse{}, invalidRequest("invalid ip or cidr: " + entry)
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		return response.APIKeyResponse{}, invalidRequest("expires_in_days must not be negative")
+	}
+	creator, err := uuid.Parse(adminGUID)
+	if err != nil {
+		return response.APIKeyResponse{}, err
+	}
+
+	prefixBytes := make([]byte, 4)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return response.APIKeyResponse{}, err
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+	secret, err := randomString(32)
+	if err != nil {
+		return response.APIKeyResponse{}, err
+	}
+
+	now := time.Now()
+	key := domain.APIKey{
+		ID:         uuid.New(),
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: hashToken(secret),
+		Scopes:     strings.Join(req.Scopes, " "),
+		AllowedIPs: strings.Join(req.AllowedIPs, " "),
+		CreatedBy:  creator,
+		CreatedAt:  now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.Insert(&key); err != nil {
+		return response.APIKeyResponse{}, err
+	}
+
+	s.bus.Publish(event.APIKeyCreated{
+		AdminGUID:  adminGUID,
+		KeyID:      key.ID.String(),
+		Scope:      key.Scopes,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: now,
+	})
+
+	return response.APIKeyResponse{APIKey: key, Key: domain.APIKeyPrefix + prefix + "_" + secret}, nil
+}
+
+func (s *APIKeyService) GetAll(claims *auth.CustomClaims) ([]domain.APIKey, error) {
+	if _, err := keyManager(claims); err != nil {
+		return nil, err
+	}
+	return s.repo.GetAll()
+}
+
+func (s *APIKeyService) Revoke(claims *auth.CustomClaims, id string, client domain.ClientInfo) error {
+	adminGUID, err := keyManager(claims)
+	if err != nil {
+		return err
+	}
+	keyID, err := uuid.Parse(id)
+	if err != nil {
+		return WithDetail(ErrNotFound, "api key not found")
+	}
+	revoked, err := s.repo.Revoke(keyID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return WithDetail(ErrNotFound, "api key not found")
+	}
+
+	s.bus.Publish(event.APIKeyRevoked{
+		AdminGUID:  adminGUID,
+		KeyID:      id,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: time.Now(),
+	})
+	return nil
+}
+
+// keyManager возвращает GUID администратора. Ключами управляют только с access token: иначе
+// утёкший ключ или PAT позволял бы выпускать новые ключи, переживающие его отзыв.
+func keyManager(claims *auth.CustomClaims) (string, error) {
+	switch claims.ClientID {
+	case APIKeyClientID:
+		return "", WithDetail(ErrForbidden, "api key cannot manage api keys")
+	case PersonalTokenClientID:
+		return "", WithDetail(ErrForbidden, "personal access token cannot manage api keys")
+	}
+	return claims.Subject, nil
+}
+
+// Authenticate ищет ключ по prefix и сравнивает хеш секрета за постоянное время.
+func (s *APIKeyService) Authenticate(key, ip string) (*auth.CustomClaims, error) {
+	prefix, secret, found := strings.Cut(strings.TrimPrefix(key, domain.APIKeyPrefix), "_")
+	if !strings.HasPrefix(key, domain.APIKeyPrefix) || !found {
+		return nil, WithDetail(ErrInvalidToken, "invalid api key")
+	}
+
+	apiKey, err := s.repo.FindByPrefix(prefix)
+	if err != nil {
+		return nil, WithDetail(ErrInvalidToken, "invalid api key")
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.SecretHash), []byte(hashToken(secret))) != 1 {
+		return nil, WithDetail(ErrInvalidToken, "invalid api key")
+	}
+	now := time.Now()
+	if !apiKey.IsActive(now) {
+		return nil, WithDetail(ErrTokenExpired, "api key expired or revoked")
+	}
+	if !apiKey.AllowsIP(ip) {
+		return nil, WithDetail(ErrForbidden, "api key not allowed from this address")
+	}
+
+	if err := s.repo.RecordUsage(apiKey.ID, ip, now); err != nil {
+		return nil, err
+	}
+
+	claims := &auth.CustomClaims{
+		IP:       ip,
+		Scope:    apiKey.Scopes,
+		ClientID: APIKeyClientID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:  apiKey.ID.String(),
+			IssuedAt: apiKey.CreatedAt.Unix(),
+		},
+	}
+	if hasScope(apiKey.Scopes, ScopeAdmin) {
+		claims.Role = domain.RoleAdmin
+	}
+	if apiKey.ExpiresAt != nil {
+		claims.ExpiresAt = apiKey.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
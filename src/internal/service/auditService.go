@@ -0,0 +1,279 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/logger"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const auditVerifyBatchSize = 1000
+
+type AuditService struct {
+	repo   repository.AuditRepositoryInterface
+	signer auth.SignerInterface
+}
+
+type AuditServiceInterface interface {
+	Register(bus event.BusInterface)
+	Find(filter repository.AuditFilter, cursor string, limit int) ([]domain.AuditEvent, string, error)
+	VerifyChain() (*ChainBreak, error)
+	CreateCheckpoint() (*domain.AuditCheckpoint, error)
+	StartCheckpoints(interval time.Duration)
+}
+
+type ChainBreak struct {
+	Seq    int64
+	Reason string
+}
+
+func NewAuditService(repo repository.AuditRepositoryInterface, signer auth.SignerInterface) *AuditService {
+	return &AuditService{repo: repo, signer: signer}
+}
+
+func (s *AuditService) Register(bus event.BusInterface) {
+	bus.SubscribeAll(s.record)
+}
+
+func (s *AuditService) Find(filter repository.AuditFilter, cursor string, limit int) ([]domain.AuditEvent, string, error) {
+	after, err := decodeAuditCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	events, err := s.repo.Find(filter, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(events) == limit {
+		last := events[len(events)-1]
+		nextCursor = encodeAuditCursor(repository.AuditCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return events, nextCursor, nil
+}
+
+func (s *AuditService) record(e event.Event) error {
+	var auditEvent domain.AuditEvent
+	var userGUID string
+
+	switch ev := e.(type) {
+	case event.UserSignedUp:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditSignUp, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, CreatedAt: ev.OccurredAt}
+	case event.UserSignedIn:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditSignIn, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, CreatedAt: ev.OccurredAt}
+	case event.SignInFailed:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditSignIn, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultFailure, Reason: ev.Reason, CreatedAt: ev.OccurredAt}
+	case event.TokenRefreshed:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditRefresh, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, CreatedAt: ev.OccurredAt}
+	case event.TokenRefreshFailed:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditRefresh, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultFailure, Reason: ev.Reason, CreatedAt: ev.OccurredAt}
+	case event.SuspiciousIPDetected:
+		userGUID = ev.UserGUID
+		reason := fmt.Sprintf("ip changed from %s to %s", ev.OldIP, ev.NewIP)
+		auditEvent = domain.AuditEvent{EventType: domain.AuditIPWarning, IP: ev.NewIP, UserAgent: ev.UserAgent, Result: domain.AuditResultFailure, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.UserLoggedOut:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditLogout, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: ev.Reason, CreatedAt: ev.OccurredAt}
+	case event.AccountLocked:
+		userGUID = ev.UserGUID
+		reason := "session " + ev.SessionID + " locked until " + ev.LockedUntil.UTC().Format(time.RFC3339)
+		auditEvent = domain.AuditEvent{EventType: domain.AuditLocked, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultFailure, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.AccountUnlocked:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditUnlocked, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "unlocked by " + ev.AdminGUID, CreatedAt: ev.OccurredAt}
+	case event.ClientTokenIssued:
+		reason := "client " + ev.ClientID + " scope " + ev.Scope
+		auditEvent = domain.AuditEvent{EventType: domain.AuditClientToken, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.TokenExchanged:
+		userGUID = ev.UserGUID
+		reason := "actor " + ev.ActorGUID + " client " + ev.ClientID + " audience " + ev.Audience + " scope " + ev.Scope
+		auditEvent = domain.AuditEvent{EventType: domain.AuditExchange, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.IdentityLinked:
+		userGUID = ev.UserGUID
+		reason := "provider " + ev.Provider + " subject " + ev.Subject
+		auditEvent = domain.AuditEvent{EventType: domain.AuditLinked, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.PersonalTokenCreated:
+		userGUID = ev.UserGUID
+		reason := "token " + ev.TokenID + " scope " + ev.Scope
+		auditEvent = domain.AuditEvent{EventType: domain.AuditPATCreated, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.PersonalTokenRevoked:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditPATRevoked, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "token " + ev.TokenID, CreatedAt: ev.OccurredAt}
+	case event.APIKeyCreated:
+		userGUID = ev.AdminGUID
+		reason := "key " + ev.KeyID + " scope " + ev.Scope
+		auditEvent = domain.AuditEvent{EventType: domain.AuditAPIKeyCreated, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: reason, CreatedAt: ev.OccurredAt}
+	case event.APIKeyRevoked:
+		userGUID = ev.AdminGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditAPIKeyRevoked, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "key " + ev.KeyID, CreatedAt: ev.OccurredAt}
+	case event.EmailChanged:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditEmailChanged, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "changed by " + ev.ActorGUID, CreatedAt: ev.OccurredAt}
+	case event.EmailChangeRequested:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditEmailPending, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, CreatedAt: ev.OccurredAt}
+	case event.AccountDisabled:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditDisabled, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "disabled by " + ev.AdminGUID, CreatedAt: ev.OccurredAt}
+	case event.AccountEnabled:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditEnabled, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "enabled by " + ev.AdminGUID, CreatedAt: ev.OccurredAt}
+	case event.UserDeleted:
+		userGUID = ev.UserGUID
+		auditEvent = domain.AuditEvent{EventType: domain.AuditUserDeleted, IP: ev.IP, UserAgent: ev.UserAgent, Result: domain.AuditResultSuccess, Reason: "deleted by " + ev.ActorGUID, CreatedAt: ev.OccurredAt}
+	default:
+		return nil
+	}
+
+	auditEvent.ID = uuid.New()
+	if guid, err := uuid.Parse(userGUID); err == nil {
+		auditEvent.UserGUID = &guid
+	}
+	return s.repo.Append(&auditEvent)
+}
+
+// VerifyChain проходит цепочку от первой записи и возвращает первое нарушенное звено,
+// затем сверяет подписи контрольных точек. nil означает, что цепочка цела.
+func (s *AuditService) VerifyChain() (*ChainBreak, error) {
+	prevHash := strings.Repeat("0", 64)
+	var lastSeq int64
+
+	for {
+		events, err := s.repo.FindBySeqRange(lastSeq, auditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range events {
+			current := &events[i]
+			if current.Seq != lastSeq+1 {
+				return &ChainBreak{Seq: lastSeq + 1, Reason: "missing record"}, nil
+			}
+			if current.PrevHash != prevHash {
+				return &ChainBreak{Seq: current.Seq, Reason: "prev_hash does not match previous record"}, nil
+			}
+			if current.ComputeHash() != current.Hash {
+				return &ChainBreak{Seq: current.Seq, Reason: "record content does not match its hash"}, nil
+			}
+			prevHash = current.Hash
+			lastSeq = current.Seq
+		}
+
+		if len(events) < auditVerifyBatchSize {
+			break
+		}
+	}
+
+	checkpoints, err := s.repo.GetCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	for _, checkpoint := range checkpoints {
+		if !s.signer.Verify(checkpoint.SigningPayload(), checkpoint.Signature) {
+			return &ChainBreak{Seq: checkpoint.Seq, Reason: "invalid checkpoint signature"}, nil
+		}
+		if checkpoint.Seq > lastSeq {
+			return &ChainBreak{Seq: checkpoint.Seq, Reason: "checkpoint refers to a truncated record"}, nil
+		}
+		current, err := s.repo.FindBySeq(checkpoint.Seq)
+		if err != nil {
+			return nil, err
+		}
+		if current.Hash != checkpoint.Hash {
+			return &ChainBreak{Seq: checkpoint.Seq, Reason: "record hash differs from signed checkpoint"}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *AuditService) CreateCheckpoint() (*domain.AuditCheckpoint, error) {
+	last, err := s.repo.Last()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := s.repo.LastCheckpoint()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if previous != nil && previous.Seq == last.Seq {
+		return nil, nil
+	}
+
+	checkpoint := &domain.AuditCheckpoint{
+		ID:        uuid.New(),
+		Seq:       last.Seq,
+		Hash:      last.Hash,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	checkpoint.Signature = s.signer.Sign(checkpoint.SigningPayload())
+	if err := s.repo.InsertCheckpoint(checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (s *AuditService) StartCheckpoints(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkpoint, err := s.CreateCheckpoint()
+			if err != nil {
+				logger.Log.Errorf("Ошибка создания контрольной точки аудита: %v", err)
+				continue
+			}
+			if checkpoint != nil {
+				logger.Log.Infof("Контрольная точка аудита создана: seq=%d", checkpoint.Seq)
+			}
+		}
+	}()
+}
+
+func encodeAuditCursor(cursor repository.AuditCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeAuditCursor(cursor string) (*repository.AuditCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidRequest("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, invalidRequest("invalid cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, invalidRequest("invalid cursor")
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, invalidRequest("invalid cursor")
+	}
+	return &repository.AuditCursor{CreatedAt: createdAt, ID: id}, nil
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAuditRepository повторяет AuditRepository в памяти: Append связывает запись с предыдущей так же,
+// как транзакция в Postgres.
+type fakeAuditRepository struct {
+	events      []domain.AuditEvent
+	checkpoints []domain.AuditCheckpoint
+}
+
+func (r *fakeAuditRepository) Append(e *domain.AuditEvent) error {
+	e.Seq = 1
+	e.PrevHash = strings.Repeat("0", 64)
+	if len(r.events) > 0 {
+		last := r.events[len(r.events)-1]
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+	}
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.Hash = e.ComputeHash()
+	r.events = append(r.events, *e)
+	return nil
+}
+
+func (r *fakeAuditRepository) Find(filter repository.AuditFilter, after *repository.AuditCursor, limit int) ([]domain.AuditEvent, error) {
+	return nil, nil
+}
+
+func (r *fakeAuditRepository) FindBySeqRange(afterSeq int64, limit int) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	for _, e := range r.events {
+		if e.Seq > afterSeq && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *fakeAuditRepository) FindBySeq(seq int64) (*domain.AuditEvent, error) {
+	for _, e := range r.events {
+		if e.Seq == seq {
+			return &e, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeAuditRepository) Last() (*domain.AuditEvent, error) {
+	if len(r.events) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &r.events[len(r.events)-1], nil
+}
+
+func (r *fakeAuditRepository) InsertCheckpoint(checkpoint *domain.AuditCheckpoint) error {
+	r.checkpoints = append(r.checkpoints, *checkpoint)
+	return nil
+}
+
+func (r *fakeAuditRepository) LastCheckpoint() (*domain.AuditCheckpoint, error) {
+	if len(r.checkpoints) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &r.checkpoints[len(r.checkpoints)-1], nil
+}
+
+func (r *fakeAuditRepository) GetCheckpoints() ([]domain.AuditCheckpoint, error) {
+	return r.checkpoints, nil
+}
+
+func newTestSigner(t *testing.T) *auth.JwtManager {
+	t.Helper()
+	manager, err := auth.NewManager("test-signing-key", "http://localhost:8080", time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestAuditVerifyChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(repo *fakeAuditRepository)
+		wantSeq    int64
+		wantReason string
+	}{
+		{
+			name:   "intact chain",
+			tamper: func(repo *fakeAuditRepository) {},
+		},
+		{
+			name:       "edited record",
+			tamper:     func(repo *fakeAuditRepository) { repo.events[1].Reason = "nothing happened" },
+			wantSeq:    2,
+			wantReason: "record content does not match its hash",
+		},
+		{
+			name: "edited record with recomputed hash",
+			tamper: func(repo *fakeAuditRepository) {
+				repo.events[1].Reason = "nothing happened"
+				repo.events[1].Hash = repo.events[1].ComputeHash()
+			},
+			wantSeq:    3,
+			wantReason: "prev_hash does not match previous record",
+		},
+		{
+			name:       "deleted record",
+			tamper:     func(repo *fakeAuditRepository) { repo.events = append(repo.events[:1], repo.events[2:]...) },
+			wantSeq:    2,
+			wantReason: "missing record",
+		},
+		{
+			name: "whole chain rewritten after checkpoint",
+			tamper: func(repo *fakeAuditRepository) {
+				for i := range repo.events {
+					if i > 0 {
+						repo.events[i].PrevHash = repo.events[i-1].Hash
+					}
+					if i == 1 {
+						repo.events[i].Reason = "nothing happened"
+					}
+					repo.events[i].Hash = repo.events[i].ComputeHash()
+				}
+			},
+			wantSeq:    3,
+			wantReason: "record hash differs from signed checkpoint",
+		},
+		{
+			name:       "truncated tail",
+			tamper:     func(repo *fakeAuditRepository) { repo.events = repo.events[:2] },
+			wantSeq:    3,
+			wantReason: "checkpoint refers to a truncated record",
+		},
+		{
+			name:       "forged checkpoint",
+			tamper:     func(repo *fakeAuditRepository) { repo.checkpoints[0].Hash = repo.events[0].Hash },
+			wantSeq:    3,
+			wantReason: "invalid checkpoint signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAuditRepository{}
+			service := NewAuditService(repo, newTestSigner(t))
+			bus := event.NewBus()
+			service.Register(bus)
+
+			guid := uuid.NewString()
+			now := time.Now()
+			bus.Publish(event.UserSignedUp{UserGUID: guid, IP: "10.0.0.1", OccurredAt: now})
+			bus.Publish(event.UserSignedIn{UserGUID: guid, IP: "10.0.0.1", OccurredAt: now})
+			bus.Publish(event.TokenRefreshFailed{UserGUID: guid, IP: "10.0.0.2", Reason: "invalid refresh token", OccurredAt: now})
+			if _, err := service.CreateCheckpoint(); err != nil {
+				t.Fatal(err)
+			}
+			bus.Publish(event.UserLoggedOut{UserGUID: guid, IP: "10.0.0.1", OccurredAt: now})
+
+			tt.tamper(repo)
+
+			chainBreak, err := service.VerifyChain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantReason == "" {
+				if chainBreak != nil {
+					t.Fatalf("unexpected break: %+v", chainBreak)
+				}
+				return
+			}
+			if chainBreak == nil {
+				t.Fatal("tampering was not detected")
+			}
+			if chainBreak.Seq != tt.wantSeq || chainBreak.Reason != tt.wantReason {
+				t.Errorf("break = %+v, want seq %d %q", chainBreak, tt.wantSeq, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestAuditCreateCheckpointSkipsUnchangedChain(t *testing.T) {
+	repo := &fakeAuditRepository{}
+	service := NewAuditService(repo, newTestSigner(t))
+
+	if checkpoint, err := service.CreateCheckpoint(); err != nil || checkpoint != nil {
+		t.Fatalf("empty chain: checkpoint = %+v, err = %v", checkpoint, err)
+	}
+	if err := repo.Append(&domain.AuditEvent{ID: uuid.New(), EventType: domain.AuditSignIn, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint, err := service.CreateCheckpoint(); err != nil || checkpoint == nil {
+		t.Fatalf("new record: checkpoint = %+v, err = %v", checkpoint, err)
+	}
+	if checkpoint, err := service.CreateCheckpoint(); err != nil || checkpoint != nil {
+		t.Fatalf("unchanged chain: checkpoint = %+v, err = %v", checkpoint, err)
+	}
+}
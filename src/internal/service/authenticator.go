@@ -0,0 +1,30 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/pkg/auth"
+	"strings"
+)
+
+// Authenticator принимает в заголовке Authorization как access token, так и PAT.
+// Вид токена определяется по префиксу. API ключи передаются отдельно, в X-API-Key.
+type Authenticator struct {
+	manager auth.JwtManagerInterface
+	tokens  TokenServiceInterface
+	apiKeys APIKeyServiceInterface
+}
+
+func NewAuthenticator(manager auth.JwtManagerInterface, tokens TokenServiceInterface, apiKeys APIKeyServiceInterface) *Authenticator {
+	return &Authenticator{manager: manager, tokens: tokens, apiKeys: apiKeys}
+}
+
+func (a *Authenticator) Parse(token string) (*auth.CustomClaims, error) {
+	if strings.HasPrefix(token, domain.PersonalAccessTokenPrefix) {
+		return a.tokens.Authenticate(token)
+	}
+	return a.manager.Parse(token)
+}
+
+func (a *Authenticator) ParseAPIKey(key, ip string) (*auth.CustomClaims, error) {
+	return a.apiKeys.Authenticate(key, ip)
+}
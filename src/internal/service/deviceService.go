@@ -0,0 +1,176 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/pkg/auth"
+	"crypto/rand"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	deviceCodeTTL          = 10 * time.Minute
+	devicePollInterval     = 5
+	deviceSlowDownInterval = 5
+
+	// Алфавит RFC 8628 6.1: только согласные, чтобы код было легко ввести и нельзя было сложить слово.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+func (s *OAuthService) DeviceAuthorization(req request.DeviceAuthorizationRequest, client domain.ClientInfo) (response.DeviceAuthorizationResponse, error) {
+	oauthClient, err := s.authenticateClient(req.ClientID, req.ClientSecret, client)
+	if err != nil {
+		return response.DeviceAuthorizationResponse{}, err
+	}
+	if !oauthClient.AllowsGrant(GrantDeviceCode) {
+		return response.DeviceAuthorizationResponse{}, &OAuthError{Code: "unauthorized_client", Description: "client is not allowed to use device code grant"}
+	}
+	if !oauthClient.AllowsScope(req.Scope) {
+		return response.DeviceAuthorizationResponse{}, &OAuthError{Code: "invalid_scope", Description: "requested scope is not allowed for this client"}
+	}
+
+	deviceCode, err := randomString(32)
+	if err != nil {
+		return response.DeviceAuthorizationResponse{}, err
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return response.DeviceAuthorizationResponse{}, err
+	}
+
+	code := &domain.DeviceCode{
+		DeviceCodeHash: hashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       oauthClient.ClientID,
+		Scope:          req.Scope,
+		Status:         domain.DeviceCodePending,
+		Interval:       devicePollInterval,
+		ExpiresAt:      time.Now().Add(deviceCodeTTL),
+	}
+	if err := s.repo.InsertDeviceCode(code); err != nil {
+		return response.DeviceAuthorizationResponse{}, err
+	}
+
+	// Страница для браузера, POST /device/verify остаётся для API клиентов.
+	verificationURI := s.idTokens.Issuer() + "/device"
+	return response.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: appendQuery(verificationURI, url.Values{"user_code": {formatUserCode(userCode)}}),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+func (s *OAuthService) VerifyDevice(req request.DeviceVerificationRequest, userGUID string) error {
+	code, err := s.repo.FindDeviceCodeByUserCode(normalizeUserCode(req.UserCode))
+	if err != nil || code.Status != domain.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+		return WithDetail(ErrNotFound, "user code is invalid or expired")
+	}
+
+	user, err := s.userService.findUser(userGUID)
+	if err != nil {
+		return err
+	}
+	if err := statusError(user); err != nil {
+		return err
+	}
+
+	code.UserGUID = &user.GUID
+	code.Status = domain.DeviceCodeDenied
+	if req.Approve {
+		code.Status = domain.DeviceCodeApproved
+	}
+	return s.repo.UpdateDeviceCode(code)
+}
+
+// exchangeDeviceCode обрабатывает опрос token endpoint устройством (RFC 8628, 3.4-3.5).
+func (s *OAuthService) exchangeDeviceCode(req request.TokenRequest, oauthClient *domain.OAuthClient, client domain.ClientInfo) (response.TokenResponse, error) {
+	deviceCodeHash := hashToken(req.DeviceCode)
+	code, err := s.repo.FindDeviceCode(deviceCodeHash)
+	if err != nil || code.ClientID != oauthClient.ClientID {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "unknown device_code"}
+	}
+
+	now := time.Now()
+	if now.After(code.ExpiresAt) {
+		return response.TokenResponse{}, &OAuthError{Code: "expired_token", Description: "device_code has expired"}
+	}
+
+	tooFast := code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < time.Duration(code.Interval)*time.Second
+	code.LastPolledAt = &now
+	if tooFast {
+		code.Interval += deviceSlowDownInterval
+	}
+	if err := s.repo.UpdateDeviceCode(code); err != nil {
+		return response.TokenResponse{}, err
+	}
+	if tooFast {
+		return response.TokenResponse{}, &OAuthError{Code: "slow_down", Description: "polling too frequently"}
+	}
+
+	switch code.Status {
+	case domain.DeviceCodePending:
+		return response.TokenResponse{}, &OAuthError{Code: "authorization_pending", Description: "user has not yet approved the device"}
+	case domain.DeviceCodeDenied:
+		return response.TokenResponse{}, &OAuthError{Code: "access_denied", Description: "user denied the device"}
+	case domain.DeviceCodeConsumed:
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "device_code has already been used"}
+	}
+
+	consumed, err := s.repo.ConsumeDeviceCode(deviceCodeHash)
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+	if !consumed || code.UserGUID == nil {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "device_code has already been used"}
+	}
+
+	user, err := s.userService.repo.FindByGUID(code.UserGUID.String())
+	if err != nil || !user.IsActive() {
+		return response.TokenResponse{}, &OAuthError{Code: "access_denied", Description: "user is not allowed to sign in"}
+	}
+
+	tokens, err := s.userService.issueTokens(user, auth.CustomClaims{IP: client.IP, Scope: code.Scope, ClientID: code.ClientID, Cnf: confirmation(client)}, "")
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+
+	s.userService.bus.Publish(event.UserSignedIn{UserGUID: user.GUID.String(), IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+
+	return response.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    int64(s.userService.tokenManager.GetAccessDuration().Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        code.Scope,
+	}, nil
+}
+
+func newUserCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+func normalizeUserCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Типовые ошибки сервисов. Обработчик ошибок HTTP сопоставляет им статус и стабильный код,
+// поэтому проверять их нужно через errors.Is, а не по тексту.
+var (
+	ErrInvalidRequest  = errors.New("invalid request")
+	ErrUnauthorized    = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient permissions")
+	ErrNotFound        = errors.New("resource not found")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrDuplicateEmail  = errors.New("email already registered")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenExpired    = errors.New("token expired")
+	ErrIPMismatch      = errors.New("ip address changed")
+	ErrTokenBinding    = errors.New("token is bound to another key")
+	ErrAccountDisabled = errors.New("account disabled")
+	ErrAccountPending  = errors.New("account not activated")
+	ErrAccountLocked   = errors.New("account locked")
+)
+
+// detailedError уточняет типовую ошибку сообщением для клиента. errors.Is видит типовую ошибку.
+type detailedError struct {
+	kind   error
+	detail string
+}
+
+func (e *detailedError) Error() string { return e.detail }
+func (e *detailedError) Unwrap() error { return e.kind }
+
+func WithDetail(kind error, detail string) error {
+	return &detailedError{kind: kind, detail: detail}
+}
+
+func invalidRequest(detail string) error {
+	return WithDetail(ErrInvalidRequest, detail)
+}
+
+func lockedError(session *domain.RefreshSession) error {
+	return WithDetail(ErrAccountLocked, fmt.Sprintf("refresh session locked until %s", session.LockedUntil.UTC().Format(time.RFC3339)))
+}
+
+// statusError объясняет, почему неактивная учётная запись не может войти.
+func statusError(user *domain.User) error {
+	switch user.Status {
+	case domain.UserStatusActive:
+		return nil
+	case domain.UserStatusPending:
+		return ErrAccountPending
+	case domain.UserStatusDeleted:
+		return ErrUserNotFound
+	default:
+		return ErrAccountDisabled
+	}
+}
+
+// updateError объясняет условное обновление, не затронувшее ни одной строки: пользователя удалили
+// или отключили между чтением и записью. Остальные ошибки возвращаются как есть.
+func (s *UserService) updateError(guid string, err error) error {
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	user, err := s.findUser(guid)
+	if err != nil {
+		return err
+	}
+	if err := statusError(user); err != nil {
+		return err
+	}
+	return ErrUserNotFound
+}
+
+// findUser отличает отсутствие пользователя от ошибок базы: первое — ErrUserNotFound,
+// второе возвращается как есть и становится 500.
+func (s *UserService) findUser(guid string) (*domain.User, error) {
+	if _, err := uuid.Parse(guid); err != nil {
+		return nil, ErrUserNotFound
+	}
+	user, err := s.repo.FindByGUID(guid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
@@ -0,0 +1,491 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/config"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUserRepository хранит пользователей в памяти с семантикой мягкого удаления GORM: удалённые
+// не находятся и не обновляются, пока PurgeDeleted не удалит их окончательно.
+type fakeUserRepository struct {
+	users     map[uuid.UUID]*domain.User
+	deletedAt map[uuid.UUID]time.Time
+	sessions  *fakeSessionRepository
+}
+
+func newFakeUserRepository(sessions *fakeSessionRepository) *fakeUserRepository {
+	return &fakeUserRepository{users: make(map[uuid.UUID]*domain.User), deletedAt: make(map[uuid.UUID]time.Time), sessions: sessions}
+}
+
+func (r *fakeUserRepository) live(guid uuid.UUID) (*domain.User, bool) {
+	user, ok := r.users[guid]
+	if !ok {
+		return nil, false
+	}
+	if _, deleted := r.deletedAt[guid]; deleted {
+		return nil, false
+	}
+	return user, true
+}
+
+func (r *fakeUserRepository) FindByGUID(guid string) (*domain.User, error) {
+	parsed, err := uuid.Parse(guid)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user, ok := r.live(parsed)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepository) InsertUser(user domain.User) error {
+	if _, err := r.FindByEmail(user.Email); err == nil {
+		return gorm.ErrDuplicatedKey
+	}
+	r.users[user.GUID] = &user
+	return nil
+}
+
+func (r *fakeUserRepository) FindByEmail(email string) (*domain.User, error) {
+	for guid, user := range r.users {
+		if _, ok := r.live(guid); ok && user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) GetAll(page, limit int) ([]domain.User, int64, error) {
+	return nil, 0, nil
+}
+
+// Find повторяет keyset пагинацию UserRepository: порядок по (поле, guid), страница после курсора.
+// Фильтры не поддерживаются.
+func (r *fakeUserRepository) Find(filter repository.UserFilter, sort repository.UserSort, after *repository.UserCursor, limit int) ([]domain.User, error) {
+	compare := func(user domain.User, value string, guid uuid.UUID) int {
+		byField := strings.Compare(user.Email, value)
+		if sort.Field == repository.UserSortCreatedAt {
+			createdAt, _ := time.Parse(time.RFC3339Nano, value)
+			byField = user.CreatedAt.Compare(createdAt)
+		}
+		if byField != 0 {
+			return byField
+		}
+		return strings.Compare(user.GUID.String(), guid.String())
+	}
+	ordered := func(a, b domain.User) int {
+		value := b.Email
+		if sort.Field == repository.UserSortCreatedAt {
+			value = b.CreatedAt.UTC().Format(time.RFC3339Nano)
+		}
+		if sort.Desc {
+			return -compare(a, value, b.GUID)
+		}
+		return compare(a, value, b.GUID)
+	}
+
+	var users []domain.User
+	for guid, user := range r.users {
+		if _, ok := r.live(guid); !ok {
+			continue
+		}
+		if after != nil {
+			position := compare(*user, after.Value, after.GUID)
+			if (sort.Desc && position >= 0) || (!sort.Desc && position <= 0) {
+				continue
+			}
+		}
+		users = append(users, *user)
+	}
+	slices.SortFunc(users, ordered)
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepository) Count(filter repository.UserFilter) (int64, error) {
+	return int64(len(r.users) - len(r.deletedAt)), nil
+}
+
+func (r *fakeUserRepository) update(guid uuid.UUID, activeOnly bool, apply func(user *domain.User)) error {
+	user, ok := r.live(guid)
+	if !ok || (activeOnly && !user.IsActive()) {
+		return gorm.ErrRecordNotFound
+	}
+	apply(user)
+	return nil
+}
+
+func (r *fakeUserRepository) UpdateEmail(guid uuid.UUID, email string) error {
+	return r.update(guid, false, func(user *domain.User) { user.Email, user.EmailVerified = email, false })
+}
+
+func (r *fakeUserRepository) SetPendingEmail(guid uuid.UUID, email, tokenHash string, expiry time.Time) error {
+	return r.update(guid, true, func(user *domain.User) {
+		user.PendingEmail, user.EmailChangeTokenHash, user.EmailChangeExpiry = email, tokenHash, &expiry
+	})
+}
+
+func (r *fakeUserRepository) ConfirmEmail(guid uuid.UUID, email string) error {
+	return r.update(guid, true, func(user *domain.User) {
+		user.Email, user.EmailVerified = email, true
+		user.PendingEmail, user.EmailChangeTokenHash, user.EmailChangeExpiry = "", "", nil
+	})
+}
+
+func (r *fakeUserRepository) SetStatus(guid uuid.UUID, status string) error {
+	if err := r.update(guid, false, func(user *domain.User) { user.Status = status }); err != nil {
+		return err
+	}
+	if status != domain.UserStatusActive {
+		_, _ = r.sessions.DeleteByUser(guid)
+	}
+	return nil
+}
+
+func (r *fakeUserRepository) DeleteUser(guid uuid.UUID) error {
+	if err := r.update(guid, false, func(user *domain.User) { user.Status = domain.UserStatusDeleted }); err != nil {
+		return err
+	}
+	_, _ = r.sessions.DeleteByUser(guid)
+	r.deletedAt[guid] = time.Now()
+	return nil
+}
+
+func (r *fakeUserRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var purged int64
+	for guid, deletedAt := range r.deletedAt {
+		if deletedAt.Before(before) {
+			delete(r.users, guid)
+			delete(r.deletedAt, guid)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// fakeSessionRepository повторяет SessionRepository: Find возвращает копию, как чтение из базы,
+// Rotate — compare-and-swap по хешу токена.
+type fakeSessionRepository struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]domain.RefreshSession
+}
+
+func newFakeSessionRepository() *fakeSessionRepository {
+	return &fakeSessionRepository{sessions: make(map[uuid.UUID]domain.RefreshSession)}
+}
+
+func (r *fakeSessionRepository) Insert(session *domain.RefreshSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *fakeSessionRepository) Find(id uuid.UUID) (*domain.RefreshSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+func (r *fakeSessionRepository) Rotate(id uuid.UUID, oldHash, newHash, jkt, x5t string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok || session.TokenHash != oldHash {
+		return false, nil
+	}
+	session.TokenHash, session.JKT, session.X5T, session.FailedAttempts = newHash, jkt, x5t, 0
+	r.sessions[id] = session
+	return true, nil
+}
+
+func (r *fakeSessionRepository) UpdateLockout(session *domain.RefreshSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.sessions[session.ID]
+	if !ok {
+		return nil
+	}
+	stored.FailedAttempts, stored.LockoutCount, stored.LockedUntil = session.FailedAttempts, session.LockoutCount, session.LockedUntil
+	r.sessions[session.ID] = stored
+	return nil
+}
+
+func (r *fakeSessionRepository) UnlockByUser(userGUID uuid.UUID) (int64, error) {
+	return r.each(func(session *domain.RefreshSession) bool {
+		if session.UserGUID != userGUID {
+			return false
+		}
+		session.FailedAttempts, session.LockoutCount, session.LockedUntil = 0, 0, nil
+		return true
+	}, false)
+}
+
+func (r *fakeSessionRepository) Delete(id uuid.UUID) (bool, error) {
+	deleted, err := r.each(func(session *domain.RefreshSession) bool { return session.ID == id }, true)
+	return deleted == 1, err
+}
+
+func (r *fakeSessionRepository) DeleteByUser(userGUID uuid.UUID) (int64, error) {
+	return r.each(func(session *domain.RefreshSession) bool { return session.UserGUID == userGUID }, true)
+}
+
+func (r *fakeSessionRepository) DeleteByClient(userGUID uuid.UUID, clientID string) (int64, error) {
+	return r.each(func(session *domain.RefreshSession) bool {
+		return session.UserGUID == userGUID && session.ClientID == clientID
+	}, true)
+}
+
+func (r *fakeSessionRepository) DeleteByAuthCode(codeHash string) (int64, error) {
+	return r.each(func(session *domain.RefreshSession) bool { return session.AuthCodeHash == codeHash }, true)
+}
+
+func (r *fakeSessionRepository) DeleteExpired(now time.Time) (int64, error) {
+	return r.each(func(session *domain.RefreshSession) bool { return session.IsExpired(now) }, true)
+}
+
+// each применяет match ко всем сессиям: совпавшие удаляются (remove) или сохраняются изменёнными.
+func (r *fakeSessionRepository) each(match func(session *domain.RefreshSession) bool, remove bool) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var affected int64
+	for id, session := range r.sessions {
+		if !match(&session) {
+			continue
+		}
+		affected++
+		if remove {
+			delete(r.sessions, id)
+		} else {
+			r.sessions[id] = session
+		}
+	}
+	return affected, nil
+}
+
+type fakeMailer struct {
+	sent []string
+}
+
+func (m *fakeMailer) Send(email, subject, body string) error {
+	m.sent = append(m.sent, email+": "+subject)
+	return nil
+}
+
+// eventRecorder запоминает опубликованные события.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []event.Event
+}
+
+func (r *eventRecorder) record(e event.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *eventRecorder) named(name string) []event.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []event.Event
+	for _, e := range r.events {
+		if e.Name() == name {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+type testUserService struct {
+	*UserService
+	users    *fakeUserRepository
+	sessions *fakeSessionRepository
+	events   *eventRecorder
+}
+
+var testLockout = config.LockoutParams{MaxAttempts: 3, BaseDuration: 15 * time.Minute, MaxDuration: 40 * time.Minute}
+
+func newTestUserService(t *testing.T) *testUserService {
+	t.Helper()
+	sessions := newFakeSessionRepository()
+	users := newFakeUserRepository(sessions)
+	events := &eventRecorder{}
+	bus := event.NewBus()
+	bus.SubscribeAll(events.record)
+	service := NewUserService(users, sessions, newTestSigner(t), bus, testLockout, &fakeMailer{})
+	return &testUserService{UserService: service, users: users, sessions: sessions, events: events}
+}
+
+func (s *testUserService) addUser(t *testing.T, role string) *domain.User {
+	t.Helper()
+	user := domain.User{
+		GUID:          uuid.New(),
+		Email:         strings.ToLower(uuid.NewString()) + "@example.com",
+		EmailVerified: true,
+		Role:          role,
+		Status:        domain.UserStatusActive,
+		CreatedAt:     time.Now(),
+	}
+	if err := s.users.InsertUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// fakeOAuthRepository хранит клиентов и коды в памяти. MarkCodeUsed и ConsumeDeviceCode атомарны,
+// как условные UPDATE в OAuthRepository.
+type fakeOAuthRepository struct {
+	mu          sync.Mutex
+	clients     map[string]domain.OAuthClient
+	codes       map[string]domain.AuthorizationCode
+	deviceCodes map[string]domain.DeviceCode
+}
+
+func newFakeOAuthRepository() *fakeOAuthRepository {
+	return &fakeOAuthRepository{clients: make(map[string]domain.OAuthClient), codes: make(map[string]domain.AuthorizationCode), deviceCodes: make(map[string]domain.DeviceCode)}
+}
+
+func (r *fakeOAuthRepository) InsertClient(client *domain.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[client.ClientID] = *client
+	return nil
+}
+
+func (r *fakeOAuthRepository) FindClient(clientID string) (*domain.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[clientID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &client, nil
+}
+
+func (r *fakeOAuthRepository) InsertCode(code *domain.AuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code.CreatedAt = time.Now()
+	r.codes[code.CodeHash] = *code
+	return nil
+}
+
+func (r *fakeOAuthRepository) FindCode(codeHash string) (*domain.AuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.codes[codeHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &code, nil
+}
+
+func (r *fakeOAuthRepository) MarkCodeUsed(codeHash string, usedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.codes[codeHash]
+	if !ok || code.UsedAt != nil {
+		return false, nil
+	}
+	code.UsedAt = &usedAt
+	r.codes[codeHash] = code
+	return true, nil
+}
+
+func (r *fakeOAuthRepository) InsertDeviceCode(code *domain.DeviceCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deviceCodes[code.DeviceCodeHash] = *code
+	return nil
+}
+
+func (r *fakeOAuthRepository) FindDeviceCode(deviceCodeHash string) (*domain.DeviceCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.deviceCodes[deviceCodeHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &code, nil
+}
+
+func (r *fakeOAuthRepository) FindDeviceCodeByUserCode(userCode string) (*domain.DeviceCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.deviceCodes {
+		if code.UserCode == userCode {
+			return &code, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOAuthRepository) UpdateDeviceCode(code *domain.DeviceCode) error {
+	return r.InsertDeviceCode(code)
+}
+
+func (r *fakeOAuthRepository) ConsumeDeviceCode(deviceCodeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.deviceCodes[deviceCodeHash]
+	if !ok || code.Status != domain.DeviceCodeApproved {
+		return false, nil
+	}
+	code.Status = domain.DeviceCodeConsumed
+	r.deviceCodes[deviceCodeHash] = code
+	return true, nil
+}
+
+type testOAuthService struct {
+	*OAuthService
+	users *testUserService
+	repo  *fakeOAuthRepository
+}
+
+func newTestOAuthService(t *testing.T) *testOAuthService {
+	t.Helper()
+	users := newTestUserService(t)
+	idTokens, err := auth.NewIDTokenSigner("", "http://localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFakeOAuthRepository()
+	return &testOAuthService{OAuthService: NewOAuthService(repo, users.UserService, idTokens, time.Minute), users: users, repo: repo}
+}
+
+// addClient сохраняет клиента в репозитории, секрет хешируется как при регистрации.
+func (s *testOAuthService) addClient(t *testing.T, client domain.OAuthClient, secret string) {
+	t.Helper()
+	if secret != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SecretHash = string(hash)
+	}
+	if err := s.repo.InsertClient(&client); err != nil {
+		t.Fatal(err)
+	}
+}
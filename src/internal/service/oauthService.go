@@ -0,0 +1,407 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	authorizationCodeTTL = 5 * time.Minute
+
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	PKCEMethodS256         = "S256"
+
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+var supportedGrantTypes = map[string]bool{
+	GrantAuthorizationCode: true,
+	GrantClientCredentials: true,
+	GrantDeviceCode:        true,
+	GrantTokenExchange:     true,
+}
+
+type OAuthError struct {
+	Code        string
+	Description string
+	RedirectURI string
+	State       string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+type OAuthService struct {
+	repo            repository.OAuthRepositoryInterface
+	userService     *UserService
+	idTokens        auth.IDTokenSignerInterface
+	idTokenDuration time.Duration
+}
+
+type OAuthServiceInterface interface {
+	RegisterClient(req request.OAuthClientRequest) (response.OAuthClientResponse, error)
+	Authorize(req request.AuthorizeRequest, userGUID string) (string, error)
+	Token(req request.TokenRequest, client domain.ClientInfo) (response.TokenResponse, error)
+	DeviceAuthorization(req request.DeviceAuthorizationRequest, client domain.ClientInfo) (response.DeviceAuthorizationResponse, error)
+	VerifyDevice(req request.DeviceVerificationRequest, userGUID string) error
+}
+
+func NewOAuthService(repo repository.OAuthRepositoryInterface, userService *UserService, idTokens auth.IDTokenSignerInterface, idTokenDuration time.Duration) *OAuthService {
+	return &OAuthService{repo: repo, userService: userService, idTokens: idTokens, idTokenDuration: idTokenDuration}
+}
+
+// RegisterClient регистрирует клиента. Секрет конфиденциального клиента возвращается только
+// в ответе на регистрацию, в базе хранится bcrypt хеш.
+func (s *OAuthService) RegisterClient(req request.OAuthClientRequest) (response.OAuthClientResponse, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return response.OAuthClientResponse{}, invalidRequest("name is required")
+	}
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{GrantAuthorizationCode}
+	}
+	for _, grantType := range req.GrantTypes {
+		if !supportedGrantTypes[grantType] {
+			return response.OAuthClientResponse{}, invalidRequest("unsupported grant type: " + grantType)
+		}
+		if (grantType == GrantClientCredentials || grantType == GrantTokenExchange) && !req.Confidential {
+			return response.OAuthClientResponse{}, invalidRequest(grantType + " grant requires a confidential client")
+		}
+		if grantType == GrantAuthorizationCode && len(req.RedirectURIs) == 0 {
+			return response.OAuthClientResponse{}, invalidRequest("at least one redirect uri is required")
+		}
+	}
+	for _, uri := range req.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.ContainsAny(uri, " \t") {
+			return response.OAuthClientResponse{}, invalidRequest("invalid redirect uri: " + uri)
+		}
+	}
+	if req.AccessTokenTTL < 0 {
+		return response.OAuthClientResponse{}, invalidRequest("access_token_ttl must not be negative")
+	}
+	if req.TLSClientAuthSubjectDN != "" && !req.Confidential {
+		return response.OAuthClientResponse{}, invalidRequest("tls client auth requires a confidential client")
+	}
+
+	clientID, err := randomString(16)
+	if err != nil {
+		return response.OAuthClientResponse{}, err
+	}
+
+	client := domain.OAuthClient{
+		ClientID:               clientID,
+		Name:                   req.Name,
+		Confidential:           req.Confidential,
+		RedirectURIs:           strings.Join(req.RedirectURIs, " "),
+		GrantTypes:             strings.Join(req.GrantTypes, " "),
+		Scopes:                 strings.Join(req.Scopes, " "),
+		Audiences:              strings.Join(req.Audiences, " "),
+		AccessTokenTTL:         req.AccessTokenTTL,
+		TLSClientAuthSubjectDN: req.TLSClientAuthSubjectDN,
+	}
+
+	// Клиент с tls_client_auth аутентифицируется сертификатом, секрет ему не выдаётся.
+	secret := ""
+	if req.Confidential && req.TLSClientAuthSubjectDN == "" {
+		secret, err = randomString(32)
+		if err != nil {
+			return response.OAuthClientResponse{}, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return response.OAuthClientResponse{}, err
+		}
+		client.SecretHash = string(hash)
+	}
+
+	if err := s.repo.InsertClient(&client); err != nil {
+		return response.OAuthClientResponse{}, err
+	}
+	return response.OAuthClientResponse{OAuthClient: client, ClientSecret: secret}, nil
+}
+
+// Authorize возвращает redirect_uri клиента с кодом авторизации. Ошибки до проверки client_id
+// и redirect_uri нельзя отправлять на redirect_uri, поэтому у них RedirectURI пустой.
+func (s *OAuthService) Authorize(req request.AuthorizeRequest, userGUID string) (string, error) {
+	client, err := s.repo.FindClient(req.ClientID)
+	if err != nil {
+		return "", &OAuthError{Code: "invalid_client", Description: "unknown client_id"}
+	}
+	if req.RedirectURI == "" || !client.HasRedirectURI(req.RedirectURI) {
+		return "", &OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+
+	redirectError := func(code, description string) error {
+		return &OAuthError{Code: code, Description: description, RedirectURI: req.RedirectURI, State: req.State}
+	}
+
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		return "", redirectError("unauthorized_client", "client is not allowed to use authorization code grant")
+	}
+	if req.ResponseType != "code" {
+		return "", redirectError("unsupported_response_type", "only response_type=code is supported")
+	}
+	if req.CodeChallenge == "" {
+		return "", redirectError("invalid_request", "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != PKCEMethodS256 {
+		return "", redirectError("invalid_request", "code_challenge_method must be S256")
+	}
+	if !client.AllowsScope(req.Scope) {
+		return "", redirectError("invalid_scope", "requested scope is not allowed for this client")
+	}
+
+	user, err := s.userService.repo.FindByGUID(userGUID)
+	if err != nil || !user.IsActive() {
+		return "", redirectError("access_denied", "user is not allowed to authorize")
+	}
+
+	code, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationCode := &domain.AuthorizationCode{
+		CodeHash:            hashToken(code),
+		ClientID:            client.ClientID,
+		UserGUID:            user.GUID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	}
+	if err := s.repo.InsertCode(authorizationCode); err != nil {
+		return "", err
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+func (s *OAuthService) Token(req request.TokenRequest, client domain.ClientInfo) (response.TokenResponse, error) {
+	if !supportedGrantTypes[req.GrantType] {
+		return response.TokenResponse{}, &OAuthError{Code: "unsupported_grant_type", Description: "grant_type is not supported"}
+	}
+
+	oauthClient, err := s.authenticateClient(req.ClientID, req.ClientSecret, client)
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+	if !oauthClient.AllowsGrant(req.GrantType) {
+		return response.TokenResponse{}, &OAuthError{Code: "unauthorized_client", Description: "client is not allowed to use this grant type"}
+	}
+
+	switch req.GrantType {
+	case GrantClientCredentials:
+		return s.clientCredentials(req, oauthClient, client)
+	case GrantDeviceCode:
+		return s.exchangeDeviceCode(req, oauthClient, client)
+	case GrantTokenExchange:
+		return s.exchangeToken(req, oauthClient, client)
+	default:
+		return s.exchangeCode(req, client)
+	}
+}
+
+// authenticateClient требует секрет у конфиденциальных клиентов, а у клиентов с tls_client_auth
+// (RFC 8705) — проверенный сертификат с зарегистрированным subject DN. Публичные клиенты
+// идентифицируются только client_id, их защищает PKCE.
+func (s *OAuthService) authenticateClient(clientID, clientSecret string, client domain.ClientInfo) (*domain.OAuthClient, error) {
+	invalidClient := &OAuthError{Code: "invalid_client", Description: "client authentication failed"}
+
+	oauthClient, err := s.repo.FindClient(clientID)
+	if err != nil {
+		return nil, invalidClient
+	}
+	if oauthClient.TLSClientAuthSubjectDN != "" {
+		if client.CertSubjectDN != oauthClient.TLSClientAuthSubjectDN {
+			return nil, invalidClient
+		}
+		return oauthClient, nil
+	}
+	if oauthClient.Confidential && bcrypt.CompareHashAndPassword([]byte(oauthClient.SecretHash), []byte(clientSecret)) != nil {
+		return nil, invalidClient
+	}
+	return oauthClient, nil
+}
+
+func (s *OAuthService) clientCredentials(req request.TokenRequest, oauthClient *domain.OAuthClient, client domain.ClientInfo) (response.TokenResponse, error) {
+	scope := req.Scope
+	if scope == "" {
+		scope = oauthClient.Scopes
+	}
+	if !oauthClient.AllowsScope(scope) {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_scope", Description: "requested scope is not allowed for this client"}
+	}
+
+	duration := s.userService.tokenManager.GetAccessDuration()
+	if oauthClient.AccessTokenTTL > 0 {
+		duration = time.Duration(oauthClient.AccessTokenTTL) * time.Second
+	}
+
+	claims := auth.CustomClaims{
+		IP:             client.IP,
+		Scope:          scope,
+		ClientID:       oauthClient.ClientID,
+		Cnf:            confirmation(client),
+		StandardClaims: jwt.StandardClaims{Subject: oauthClient.ClientID},
+	}
+	accessToken, err := s.userService.tokenManager.NewAccessTokenWithClaims(claims, duration)
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+
+	s.userService.bus.Publish(event.ClientTokenIssued{ClientID: oauthClient.ClientID, Scope: scope, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+
+	return response.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType(claims.Cnf),
+		ExpiresIn:   int64(duration.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func (s *OAuthService) exchangeCode(req request.TokenRequest, client domain.ClientInfo) (response.TokenResponse, error) {
+	invalidGrant := &OAuthError{Code: "invalid_grant", Description: "authorization code is invalid, expired or already used"}
+
+	codeHash := hashToken(req.Code)
+	code, err := s.repo.FindCode(codeHash)
+	if err != nil || code.ClientID != req.ClientID || code.RedirectURI != req.RedirectURI || time.Now().After(code.ExpiresAt) {
+		return response.TokenResponse{}, invalidGrant
+	}
+	if !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "code_verifier does not match code_challenge"}
+	}
+
+	user, err := s.userService.repo.FindByGUID(code.UserGUID.String())
+	if err != nil {
+		return response.TokenResponse{}, invalidGrant
+	}
+
+	marked, err := s.repo.MarkCodeUsed(codeHash, time.Now())
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+	if !marked {
+		// Повторное использование кода: отзываем выданные по нему токены (RFC 6749, 4.1.2).
+		if err := s.userService.revokeCodeSessions(user.GUID.String(), codeHash, client); err != nil {
+			return response.TokenResponse{}, err
+		}
+		return response.TokenResponse{}, invalidGrant
+	}
+
+	if !user.IsActive() {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "account is " + user.Status}
+	}
+
+	tokens, err := s.userService.issueTokens(user, auth.CustomClaims{IP: client.IP, Scope: code.Scope, ClientID: code.ClientID, Cnf: confirmation(client)}, codeHash)
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+
+	idToken := ""
+	if hasScope(code.Scope, ScopeOpenID) {
+		idToken, err = s.newIDToken(user, code)
+		if err != nil {
+			return response.TokenResponse{}, err
+		}
+	}
+
+	s.userService.bus.Publish(event.UserSignedIn{UserGUID: user.GUID.String(), IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+
+	return response.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    int64(s.userService.tokenManager.GetAccessDuration().Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        code.Scope,
+		IDToken:      idToken,
+	}, nil
+}
+
+func (s *OAuthService) newIDToken(user *domain.User, code *domain.AuthorizationCode) (string, error) {
+	claims := auth.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: code.CreatedAt.Unix(),
+		StandardClaims: jwt.StandardClaims{
+			Subject:  user.GUID.String(),
+			Audience: code.ClientID,
+		},
+	}
+	if hasScope(code.Scope, ScopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+	return s.idTokens.NewIDToken(claims, s.idTokenDuration)
+}
+
+func hasScope(scope, name string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPKCE проверяет code_verifier по RFC 7636: 43-128 символов, BASE64URL(SHA256(verifier)) == challenge.
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
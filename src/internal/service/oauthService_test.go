@@ -0,0 +1,261 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/payload/request"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testRedirectURI = "https://app.example.com/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		verifier  string
+		want      bool
+	}{
+		{name: "matching verifier", challenge: pkceChallenge(testVerifier), verifier: testVerifier, want: true},
+		{name: "rfc 7636 appendix b", challenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", verifier: testVerifier, want: true},
+		{name: "other verifier", challenge: pkceChallenge(testVerifier), verifier: strings.Repeat("a", 43)},
+		{name: "plain method", challenge: testVerifier, verifier: testVerifier},
+		{name: "verifier too short", challenge: pkceChallenge(strings.Repeat("a", 42)), verifier: strings.Repeat("a", 42)},
+		{name: "verifier too long", challenge: pkceChallenge(strings.Repeat("a", 129)), verifier: strings.Repeat("a", 129)},
+		{name: "empty verifier", challenge: pkceChallenge(""), verifier: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.challenge, tt.verifier); got != tt.want {
+				t.Errorf("verifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// authorize выдаёт код авторизации публичному клиенту app для нового пользователя.
+func (s *testOAuthService) authorize(t *testing.T) (*domain.User, string) {
+	t.Helper()
+	s.addClient(t, domain.OAuthClient{ClientID: "app", Name: "App", RedirectURIs: testRedirectURI, GrantTypes: GrantAuthorizationCode, Scopes: "openid email"}, "")
+	user := s.users.addUser(t, domain.RoleUser)
+	redirect, err := s.Authorize(request.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "app",
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid",
+		State:               "xyz",
+		CodeChallenge:       pkceChallenge(testVerifier),
+		CodeChallengeMethod: PKCEMethodS256,
+	}, user.GUID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Query().Get("state") != "xyz" {
+		t.Fatalf("state not returned: %s", redirect)
+	}
+	return user, parsed.Query().Get("code")
+}
+
+func TestAuthorizeRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(req *request.AuthorizeRequest)
+		wantCode string
+		redirect bool
+	}{
+		{name: "unknown client", modify: func(req *request.AuthorizeRequest) { req.ClientID = "other" }, wantCode: "invalid_client"},
+		{name: "unregistered redirect uri", modify: func(req *request.AuthorizeRequest) { req.RedirectURI = testRedirectURI + "/evil" }, wantCode: "invalid_request"},
+		{name: "missing code challenge", modify: func(req *request.AuthorizeRequest) { req.CodeChallenge = "" }, wantCode: "invalid_request", redirect: true},
+		{name: "plain challenge method", modify: func(req *request.AuthorizeRequest) { req.CodeChallengeMethod = "plain" }, wantCode: "invalid_request", redirect: true},
+		{name: "unsupported response type", modify: func(req *request.AuthorizeRequest) { req.ResponseType = "token" }, wantCode: "unsupported_response_type", redirect: true},
+		{name: "scope not allowed", modify: func(req *request.AuthorizeRequest) { req.Scope = "admin" }, wantCode: "invalid_scope", redirect: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOAuthService(t)
+			s.addClient(t, domain.OAuthClient{ClientID: "app", Name: "App", RedirectURIs: testRedirectURI, GrantTypes: GrantAuthorizationCode, Scopes: "openid"}, "")
+			user := s.users.addUser(t, domain.RoleUser)
+			req := request.AuthorizeRequest{
+				ResponseType:        "code",
+				ClientID:            "app",
+				RedirectURI:         testRedirectURI,
+				Scope:               "openid",
+				CodeChallenge:       pkceChallenge(testVerifier),
+				CodeChallengeMethod: PKCEMethodS256,
+			}
+			tt.modify(&req)
+
+			_, err := s.Authorize(req, user.GUID.String())
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantCode {
+				t.Fatalf("err = %v, want %s", err, tt.wantCode)
+			}
+			if (oauthErr.RedirectURI != "") != tt.redirect {
+				t.Errorf("redirect uri = %q, redirect expected: %v", oauthErr.RedirectURI, tt.redirect)
+			}
+		})
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(s *testOAuthService, req *request.TokenRequest)
+		wantErrDesc string
+	}{
+		{name: "valid exchange", modify: func(s *testOAuthService, req *request.TokenRequest) {}},
+		{
+			name:        "wrong verifier",
+			modify:      func(s *testOAuthService, req *request.TokenRequest) { req.CodeVerifier = strings.Repeat("a", 43) },
+			wantErrDesc: "code_verifier does not match code_challenge",
+		},
+		{
+			name:        "missing verifier",
+			modify:      func(s *testOAuthService, req *request.TokenRequest) { req.CodeVerifier = "" },
+			wantErrDesc: "code_verifier does not match code_challenge",
+		},
+		{
+			name: "different redirect uri",
+			modify: func(s *testOAuthService, req *request.TokenRequest) {
+				req.RedirectURI = "https://app.example.com/other"
+			},
+			wantErrDesc: "authorization code is invalid, expired or already used",
+		},
+		{
+			name: "code issued to another client",
+			modify: func(s *testOAuthService, req *request.TokenRequest) {
+				s.addClient(t, domain.OAuthClient{ClientID: "other", Name: "Other", RedirectURIs: testRedirectURI, GrantTypes: GrantAuthorizationCode}, "")
+				req.ClientID = "other"
+			},
+			wantErrDesc: "authorization code is invalid, expired or already used",
+		},
+		{
+			name: "expired code",
+			modify: func(s *testOAuthService, req *request.TokenRequest) {
+				code := s.repo.codes[hashToken(req.Code)]
+				code.ExpiresAt = time.Now().Add(-time.Second)
+				s.repo.codes[code.CodeHash] = code
+			},
+			wantErrDesc: "authorization code is invalid, expired or already used",
+		},
+		{
+			name: "disabled user",
+			modify: func(s *testOAuthService, req *request.TokenRequest) {
+				code := s.repo.codes[hashToken(req.Code)]
+				s.users.users.users[code.UserGUID].Status = domain.UserStatusDisabled
+			},
+			wantErrDesc: "account is disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOAuthService(t)
+			_, code := s.authorize(t)
+			req := request.TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirectURI, ClientID: "app", CodeVerifier: testVerifier}
+			tt.modify(s, &req)
+
+			tokens, err := s.Token(req, testClient)
+			if tt.wantErrDesc == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.IDToken == "" {
+					t.Errorf("incomplete token response: %+v", tokens)
+				}
+				return
+			}
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" || oauthErr.Description != tt.wantErrDesc {
+				t.Fatalf("err = %v, want invalid_grant: %s", err, tt.wantErrDesc)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeReuseRevokesIssuedTokens(t *testing.T) {
+	s := newTestOAuthService(t)
+	user, code := s.authorize(t)
+	req := request.TokenRequest{GrantType: GrantAuthorizationCode, Code: code, RedirectURI: testRedirectURI, ClientID: "app", CodeVerifier: testVerifier}
+
+	tokens, err := s.Token(req, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.users.SignIn(user.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Token(req, testClient)
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("reused code: err = %v, want invalid_grant", err)
+	}
+	if _, err := s.users.RefreshTokens(tokens.AccessToken, tokens.RefreshToken, testClient); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh after code reuse: err = %v, want invalid token", err)
+	}
+	if _, err := s.users.RefreshTokens(other.AccessToken, other.RefreshToken, testClient); err != nil {
+		t.Errorf("session not issued by the code must survive: %v", err)
+	}
+}
+
+func TestClientCredentialsTLSClientAuth(t *testing.T) {
+	const subjectDN = "CN=billing,O=Example"
+	tests := []struct {
+		name     string
+		client   domain.ClientInfo
+		secret   string
+		wantCode string
+	}{
+		{name: "registered certificate", client: domain.ClientInfo{IP: testClient.IP, CertSubjectDN: subjectDN, CertThumbprint: "cert-1"}},
+		{name: "another subject", client: domain.ClientInfo{IP: testClient.IP, CertSubjectDN: "CN=evil,O=Example", CertThumbprint: "cert-2"}, wantCode: "invalid_client"},
+		{name: "no certificate", client: testClient, wantCode: "invalid_client"},
+		{name: "secret instead of certificate", client: testClient, secret: "secret", wantCode: "invalid_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOAuthService(t)
+			s.addClient(t, domain.OAuthClient{ClientID: "billing", Name: "Billing", Confidential: true, GrantTypes: GrantClientCredentials, Scopes: "read", TLSClientAuthSubjectDN: subjectDN}, "")
+
+			tokens, err := s.Token(request.TokenRequest{GrantType: GrantClientCredentials, ClientID: "billing", ClientSecret: tt.secret}, tt.client)
+			if tt.wantCode != "" {
+				var oauthErr *OAuthError
+				if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantCode {
+					t.Fatalf("err = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := s.users.tokenManager.Parse(tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Cnf == nil || claims.Cnf.X5T != tt.client.CertThumbprint || tokens.TokenType != "Bearer" {
+				t.Errorf("token is not bound to the certificate: cnf %+v, type %s", claims.Cnf, tokens.TokenType)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/dpop"
+	"net/url"
+)
+
+type OIDCService struct {
+	oauthService *OAuthService
+}
+
+type OIDCServiceInterface interface {
+	Discovery() response.DiscoveryResponse
+	JWKS() auth.JSONWebKeySet
+	UserInfo(claims *auth.CustomClaims) (response.UserInfoResponse, error)
+	EndSession(req request.EndSessionRequest, client domain.ClientInfo) (string, error)
+}
+
+func NewOIDCService(oauthService *OAuthService) *OIDCService {
+	return &OIDCService{oauthService: oauthService}
+}
+
+func (s *OIDCService) Discovery() response.DiscoveryResponse {
+	issuer := s.oauthService.idTokens.Issuer()
+	return response.DiscoveryResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JwksURI:                           issuer + "/.well-known/jwks.json",
+		EndSessionEndpoint:                issuer + "/logout",
+		DeviceAuthorizationEndpoint:       issuer + "/device_authorization",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantClientCredentials, GrantDeviceCode, GrantTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post", "tls_client_auth"},
+		CodeChallengeMethodsSupported:     []string{PKCEMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+		DPoPSigningAlgValuesSupported:     dpop.SupportedAlgorithms,
+		TLSClientCertificateBoundTokens:   true,
+	}
+}
+
+func (s *OIDCService) JWKS() auth.JSONWebKeySet {
+	return s.oauthService.idTokens.JWKS()
+}
+
+// UserInfo отдаёт email, если токен выдан без scope (signIn) или со scope email.
+func (s *OIDCService) UserInfo(claims *auth.CustomClaims) (response.UserInfoResponse, error) {
+	user, err := s.oauthService.userService.findUser(claims.Subject)
+	if err != nil {
+		return response.UserInfoResponse{}, err
+	}
+
+	userInfo := response.UserInfoResponse{Sub: user.GUID.String()}
+	if claims.Scope == "" || hasScope(claims.Scope, ScopeEmail) {
+		userInfo.Email = user.Email
+		userInfo.EmailVerified = &user.EmailVerified
+	}
+	return userInfo, nil
+}
+
+// EndSession отзывает refresh сессии пользователя из id_token_hint у клиента, которому выдан ID token, и возвращает адрес для redirect.
+// Пустая строка означает, что post_logout_redirect_uri не передан.
+func (s *OIDCService) EndSession(req request.EndSessionRequest, client domain.ClientInfo) (string, error) {
+	if req.IDTokenHint == "" {
+		return "", &OAuthError{Code: "invalid_request", Description: "id_token_hint is required"}
+	}
+	idClaims, err := s.oauthService.idTokens.ParseIDToken(req.IDTokenHint)
+	if err != nil {
+		return "", &OAuthError{Code: "invalid_request", Description: "invalid id_token_hint"}
+	}
+	if req.ClientID != "" && req.ClientID != idClaims.Audience {
+		return "", &OAuthError{Code: "invalid_request", Description: "client_id does not match id_token_hint"}
+	}
+
+	redirectURI := ""
+	if req.PostLogoutRedirectURI != "" {
+		oauthClient, err := s.oauthService.repo.FindClient(idClaims.Audience)
+		if err != nil || !oauthClient.HasRedirectURI(req.PostLogoutRedirectURI) {
+			return "", &OAuthError{Code: "invalid_request", Description: "post_logout_redirect_uri is not registered for this client"}
+		}
+		redirectURI = req.PostLogoutRedirectURI
+		if req.State != "" {
+			redirectURI = appendQuery(redirectURI, url.Values{"state": {req.State}})
+		}
+	}
+
+	user, err := s.oauthService.userService.repo.FindByGUID(idClaims.Subject)
+	if err != nil {
+		return "", &OAuthError{Code: "invalid_request", Description: "user not found"}
+	}
+	if err := s.oauthService.userService.revokeClientSessions(user, idClaims.Audience, client, "end session"); err != nil {
+		return "", err
+	}
+	return redirectURI, nil
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/sso"
+	"crypto/subtle"
+	"github.com/google/uuid"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSOStateTTL — сколько ждать возврата от провайдера. На этот же срок браузеру выставляется cookie со state.
+const SSOStateTTL = 10 * time.Minute
+
+type ssoState struct {
+	provider     string
+	nonce        string
+	codeVerifier string
+	// linkUserGUID задан, если вход начат из сессии пользователя для явной привязки провайдера.
+	linkUserGUID string
+	returnTo     string
+	expiresAt    time.Time
+}
+
+// SSOResult — итог callback: access token браузерной сессии и локальный путь, куда вернуть браузер.
+type SSOResult struct {
+	AccessToken string
+	ReturnTo    string
+}
+
+// SSOService хранит state незавершённых входов в памяти процесса: callback должен прийти
+// на тот же экземпляр, который выдал redirect. Кроме того, state принимается только вместе
+// с cookie браузера, начавшего вход, иначе злоумышленник мог бы подсунуть жертве свой callback.
+type SSOService struct {
+	providers   map[string]sso.ProviderInterface
+	identities  repository.IdentityRepositoryInterface
+	userService *UserService
+
+	mu     sync.Mutex
+	states map[string]ssoState
+}
+
+type SSOServiceInterface interface {
+	LoginURL(provider, linkUserGUID, returnTo string) (string, string, error)
+	Callback(provider, state, browserState, code string, client domain.ClientInfo) (SSOResult, error)
+}
+
+func NewSSOService(providers []sso.ProviderInterface, identities repository.IdentityRepositoryInterface, userService *UserService) *SSOService {
+	byName := make(map[string]sso.ProviderInterface, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &SSOService{providers: byName, identities: identities, userService: userService, states: make(map[string]ssoState)}
+}
+
+// LoginURL возвращает адрес авторизации у провайдера и state, который нужно сохранить в cookie браузера.
+// С linkUserGUID вход привязывает внешнюю учётную запись к этому пользователю вместо поиска по email.
+func (s *SSOService) LoginURL(providerName, linkUserGUID, returnTo string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", WithDetail(ErrNotFound, "unknown provider")
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	loginURL, err := provider.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, st := range s.states {
+		if now.After(st.expiresAt) {
+			delete(s.states, key)
+		}
+	}
+	s.states[state] = ssoState{
+		provider:     providerName,
+		nonce:        nonce,
+		codeVerifier: codeVerifier,
+		linkUserGUID: linkUserGUID,
+		returnTo:     returnTo,
+		expiresAt:    now.Add(SSOStateTTL),
+	}
+
+	return loginURL, state, nil
+}
+
+// Callback завершает вход: browserState — значение cookie, выставленной при LoginURL. Выдаётся access token
+// браузерной сессии, как после /login; refresh сессия не создаётся.
+func (s *SSOService) Callback(providerName, state, browserState, code string, client domain.ClientInfo) (SSOResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return SSOResult{}, WithDetail(ErrNotFound, "unknown provider")
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return SSOResult{}, invalidRequest("state does not match this browser")
+	}
+
+	s.mu.Lock()
+	pending, ok := s.states[state]
+	delete(s.states, state)
+	s.mu.Unlock()
+	if !ok || pending.provider != providerName || time.Now().After(pending.expiresAt) {
+		return SSOResult{}, invalidRequest("invalid or expired state")
+	}
+
+	idToken, err := provider.Exchange(code, pending.codeVerifier)
+	if err != nil {
+		return SSOResult{}, err
+	}
+	claims, err := provider.VerifyIDToken(idToken, pending.nonce)
+	if err != nil {
+		return SSOResult{}, err
+	}
+
+	var user *domain.User
+	if pending.linkUserGUID != "" {
+		user, err = s.linkUser(pending.linkUserGUID, providerName, claims, client)
+	} else {
+		user, err = s.resolveUser(providerName, claims, client)
+	}
+	if err != nil {
+		return SSOResult{}, err
+	}
+	if err := statusError(user); err != nil {
+		s.userService.bus.Publish(event.SignInFailed{UserGUID: user.GUID.String(), IP: client.IP, UserAgent: client.UserAgent, Reason: "account " + user.Status, OccurredAt: time.Now()})
+		return SSOResult{}, err
+	}
+
+	accessToken, err := s.userService.sessionToken(user, client)
+	if err != nil {
+		return SSOResult{}, err
+	}
+	return SSOResult{AccessToken: accessToken, ReturnTo: pending.returnTo}, nil
+}
+
+// resolveUser находит пользователя по привязанной внешней учётной записи, а при первом входе
+// привязывает её по email. Email принимается только подтверждённым провайдером, иначе
+// чужой аккаунт можно было бы захватить, указав его адрес у провайдера. Локальная учётная
+// запись с неподтверждённым email автоматически не привязывается: её мог заранее создать
+// злоумышленник. Владелец такой учётной записи привязывает провайдера явно через linkUser.
+func (s *SSOService) resolveUser(providerName string, claims *sso.IdentityClaims, client domain.ClientInfo) (*domain.User, error) {
+	if identity, err := s.identities.Find(providerName, claims.Subject); err == nil {
+		return s.userService.findUser(identity.UserGUID.String())
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, WithDetail(ErrForbidden, "provider did not return a verified email")
+	}
+	email := strings.ToLower(claims.Email)
+
+	user, err := s.userService.repo.FindByEmail(email)
+	if err != nil {
+		user = &domain.User{GUID: uuid.New(), Email: email, EmailVerified: true, Role: domain.RoleUser, Status: domain.UserStatusActive}
+		if err := s.userService.repo.InsertUser(*user); err != nil {
+			return nil, err
+		}
+		s.userService.bus.Publish(event.UserSignedUp{UserGUID: user.GUID.String(), Email: email, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	} else if !user.EmailVerified {
+		return nil, WithDetail(ErrForbidden, "local account email is not verified: sign in and link the provider at /sso/"+providerName+"/link")
+	}
+
+	if err := s.link(user, providerName, claims, client); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// linkUser привязывает внешнюю учётную запись к пользователю, который начал вход из своей сессии.
+// Владение обеими учётными записями подтверждено: локальной — сессией, внешней — входом у провайдера,
+// поэтому email провайдера здесь не сравнивается и может быть не подтверждён.
+func (s *SSOService) linkUser(userGUID, providerName string, claims *sso.IdentityClaims, client domain.ClientInfo) (*domain.User, error) {
+	user, err := s.userService.findUser(userGUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity, err := s.identities.Find(providerName, claims.Subject); err == nil {
+		if identity.UserGUID != user.GUID {
+			return nil, WithDetail(ErrForbidden, "external account is already linked to another user")
+		}
+		return user, nil
+	}
+
+	if err := s.link(user, providerName, claims, client); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SSOService) link(user *domain.User, providerName string, claims *sso.IdentityClaims, client domain.ClientInfo) error {
+	identity := &domain.ExternalIdentity{ID: uuid.New(), Provider: providerName, Subject: claims.Subject, UserGUID: user.GUID, Email: strings.ToLower(claims.Email)}
+	if err := s.identities.Insert(identity); err != nil {
+		return err
+	}
+	s.userService.bus.Publish(event.IdentityLinked{UserGUID: user.GUID.String(), Provider: providerName, Subject: claims.Subject, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/pkg/auth"
+	"github.com/golang-jwt/jwt"
+	"time"
+)
+
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	// TokenTypeUserGUID — subject_token_type для имперсонации: subject_token содержит GUID пользователя,
+	// а не его токен. Принимается только вместе с actor_token администратора.
+	TokenTypeUserGUID = "urn:jwttesttask:params:oauth:token-type:user_guid"
+)
+
+// exchangeToken реализует RFC 8693. Без actor_token это делегирование: шлюз (клиент) получает
+// более узкий токен пользователя для другого сервиса. С actor_token это имперсонация сотрудником
+// поддержки, допустимая только для администратора: вместо токена пользователя достаточно его GUID
+// (TokenTypeUserGUID). В обоих случаях act фиксирует, кто действует. Токен для другого audience
+// подписывается ключом OIDC (RS256) и проверяется по JWKS, а не общим секретом JWT_SIGNING_KEY.
+func (s *OAuthService) exchangeToken(req request.TokenRequest, oauthClient *domain.OAuthClient, client domain.ClientInfo) (response.TokenResponse, error) {
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_request", Description: "only access tokens can be requested"}
+	}
+
+	tokenManager := s.userService.tokenManager
+	var actor *auth.CustomClaims
+	if req.ActorToken != "" {
+		var err error
+		if actor, err = s.parseActor(req, client); err != nil {
+			return response.TokenResponse{}, err
+		}
+	}
+
+	var subject *auth.CustomClaims
+	switch {
+	case isAccessTokenType(req.SubjectTokenType):
+		var err error
+		subject, err = tokenManager.Parse(req.SubjectToken)
+		if err != nil {
+			return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "invalid subject_token"}
+		}
+		if !boundTo(subject.Cnf, client) {
+			return response.TokenResponse{}, &OAuthError{Code: "invalid_grant", Description: "subject_token is bound to a different key"}
+		}
+	case req.SubjectTokenType == TokenTypeUserGUID:
+		if actor == nil {
+			return response.TokenResponse{}, &OAuthError{Code: "invalid_request", Description: "user_guid subject_token requires an admin actor_token"}
+		}
+		var err error
+		if subject, err = s.impersonatedSubject(req, actor); err != nil {
+			return response.TokenResponse{}, err
+		}
+	default:
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_request", Description: "unsupported subject_token_type"}
+	}
+
+	act := &auth.ActorClaims{Subject: oauthClient.ClientID, ClientID: oauthClient.ClientID, Act: subject.Act}
+	if actor != nil {
+		act = &auth.ActorClaims{Subject: actor.Subject, ClientID: oauthClient.ClientID, Act: subject.Act}
+	}
+
+	if req.Audience != "" && !oauthClient.AllowsAudience(req.Audience) {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_target", Description: "audience is not allowed for this client"}
+	}
+
+	// Токен без scope не даёт никаких scope и при обмене.
+	scope := req.Scope
+	if scope == "" {
+		scope = subject.Scope
+	}
+	if !domain.ScopeSubset(scope, subject.Scope) {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_scope", Description: "requested scope exceeds subject_token scope"}
+	}
+	if !oauthClient.AllowsScope(scope) {
+		return response.TokenResponse{}, &OAuthError{Code: "invalid_scope", Description: "requested scope is not allowed for this client"}
+	}
+
+	// Новый токен не может пережить исходный.
+	duration := tokenManager.GetAccessDuration()
+	if oauthClient.AccessTokenTTL > 0 {
+		duration = time.Duration(oauthClient.AccessTokenTTL) * time.Second
+	}
+	if remaining := time.Until(time.Unix(subject.ExpiresAt, 0)); remaining < duration {
+		duration = remaining
+	}
+
+	claims := auth.CustomClaims{
+		IP:       subject.IP,
+		Scope:    scope,
+		ClientID: oauthClient.ClientID,
+		Act:      act,
+		Cnf:      confirmation(client),
+		StandardClaims: jwt.StandardClaims{
+			Subject:  subject.Subject,
+			Audience: req.Audience,
+		},
+	}
+	var accessToken string
+	var err error
+	if req.Audience != "" && req.Audience != s.idTokens.Issuer() {
+		accessToken, err = s.idTokens.NewAccessToken(claims, duration)
+	} else {
+		accessToken, err = tokenManager.NewAccessTokenWithClaims(claims, duration)
+	}
+	if err != nil {
+		return response.TokenResponse{}, err
+	}
+
+	s.userService.bus.Publish(event.TokenExchanged{
+		UserGUID:   subject.Subject,
+		ActorGUID:  act.Subject,
+		ClientID:   oauthClient.ClientID,
+		Audience:   req.Audience,
+		Scope:      scope,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: time.Now(),
+	})
+
+	return response.TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       tokenType(claims.Cnf),
+		ExpiresIn:       int64(duration.Seconds()),
+		Scope:           scope,
+	}, nil
+}
+
+// parseActor принимает actor_token только от администратора, вошедшего сам: токен клиента или обмена
+// (client_id, act) не даёт права на имперсонацию, даже если выдан администратору.
+func (s *OAuthService) parseActor(req request.TokenRequest, client domain.ClientInfo) (*auth.CustomClaims, error) {
+	if !isAccessTokenType(req.ActorTokenType) {
+		return nil, &OAuthError{Code: "invalid_request", Description: "unsupported actor_token_type"}
+	}
+	actor, err := s.userService.tokenManager.Parse(req.ActorToken)
+	if err != nil {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "invalid actor_token"}
+	}
+	if !boundTo(actor.Cnf, client) {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "actor_token is bound to a different key"}
+	}
+	if actor.Role != domain.RoleAdmin || actor.Act != nil || actor.ClientID != "" {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "actor is not allowed to impersonate users"}
+	}
+	return actor, nil
+}
+
+// impersonatedSubject строит subject по GUID пользователя для имперсонации. Пользователь должен быть
+// активен, токен не переживает actor_token, scope ограничен только разрешениями клиента.
+func (s *OAuthService) impersonatedSubject(req request.TokenRequest, actor *auth.CustomClaims) (*auth.CustomClaims, error) {
+	user, err := s.userService.findUser(req.SubjectToken)
+	if err != nil || !user.IsActive() {
+		return nil, &OAuthError{Code: "invalid_grant", Description: "subject user is not allowed to sign in"}
+	}
+	return &auth.CustomClaims{
+		IP:             actor.IP,
+		Scope:          req.Scope,
+		StandardClaims: jwt.StandardClaims{Subject: user.GUID.String(), ExpiresAt: actor.ExpiresAt},
+	}, nil
+}
+
+func isAccessTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
+
+// boundTo проверяет, что привязанный (DPoP или mTLS) токен обменивает его владелец: запрос к /token
+// подписан тем же ключом DPoP и пришёл с тем же клиентским сертификатом.
+func boundTo(cnf *auth.Confirmation, client domain.ClientInfo) bool {
+	if cnf == nil {
+		return true
+	}
+	if cnf.JKT != "" && cnf.JKT != client.DPoPJKT {
+		return false
+	}
+	return cnf.X5T == "" || cnf.X5T == client.CertThumbprint
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/pkg/auth"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"testing"
+)
+
+const (
+	testGatewaySecret = "gateway-secret"
+	testAudience      = "https://api.example.com"
+)
+
+// exchangeEnv — участники обмена: пользователь с токеном, администратор с токеном и шлюз gateway.
+type exchangeEnv struct {
+	user       *domain.User
+	userToken  string
+	admin      *domain.User
+	adminToken string
+}
+
+func newExchangeEnv(t *testing.T, s *testOAuthService) exchangeEnv {
+	t.Helper()
+	s.addClient(t, domain.OAuthClient{
+		ClientID:     "gateway",
+		Name:         "Gateway",
+		Confidential: true,
+		GrantTypes:   GrantTokenExchange + " " + GrantClientCredentials,
+		Scopes:       "read write",
+		Audiences:    testAudience,
+	}, testGatewaySecret)
+
+	env := exchangeEnv{user: s.users.addUser(t, domain.RoleUser), admin: s.users.addUser(t, domain.RoleAdmin)}
+	var err error
+	if env.userToken, err = s.users.tokenManager.NewAccessTokenWithClaims(auth.CustomClaims{
+		IP:             testClient.IP,
+		Role:           domain.RoleUser,
+		Scope:          "read write",
+		StandardClaims: jwt.StandardClaims{Subject: env.user.GUID.String()},
+	}, s.users.tokenManager.GetAccessDuration()); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := s.users.SignIn(env.admin.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.adminToken = tokens.AccessToken
+	return env
+}
+
+func (s *testOAuthService) exchange(req request.TokenRequest, client domain.ClientInfo) (string, error) {
+	req.GrantType, req.ClientID, req.ClientSecret = GrantTokenExchange, "gateway", testGatewaySecret
+	tokens, err := s.Token(req, client)
+	return tokens.AccessToken, err
+}
+
+func TestTokenExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest
+		wantCode string
+		wantDesc string
+		// wantActor — "client" или "admin": кто должен оказаться в act.sub.
+		wantActor string
+		wantAlg   string
+	}{
+		{
+			name: "delegation",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.userToken, SubjectTokenType: TokenTypeAccessToken, Scope: "read"}
+			},
+			wantActor: "client",
+			wantAlg:   "HS512",
+		},
+		{
+			name: "delegation to another audience is signed with the oidc key",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.userToken, SubjectTokenType: TokenTypeAccessToken, Audience: testAudience}
+			},
+			wantActor: "client",
+			wantAlg:   "RS256",
+		},
+		{
+			name: "scope wider than subject token",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				token, err := s.users.tokenManager.NewAccessTokenWithClaims(auth.CustomClaims{Scope: "read", StandardClaims: jwt.StandardClaims{Subject: env.user.GUID.String()}}, s.users.tokenManager.GetAccessDuration())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return request.TokenRequest{SubjectToken: token, SubjectTokenType: TokenTypeAccessToken, Scope: "read write"}
+			},
+			wantCode: "invalid_scope",
+			wantDesc: "requested scope exceeds subject_token scope",
+		},
+		{
+			name: "audience not allowed",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.userToken, SubjectTokenType: TokenTypeAccessToken, Audience: "https://evil.example.com"}
+			},
+			wantCode: "invalid_target",
+		},
+		{
+			name: "unsupported requested token type",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.userToken, SubjectTokenType: TokenTypeAccessToken, RequestedTokenType: "urn:ietf:params:oauth:token-type:id_token"}
+			},
+			wantCode: "invalid_request",
+		},
+		{
+			name: "dpop-bound subject token without the key",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				token, err := s.users.tokenManager.NewAccessTokenWithClaims(auth.CustomClaims{Scope: "read", Cnf: &auth.Confirmation{JKT: "thumbprint"}, StandardClaims: jwt.StandardClaims{Subject: env.user.GUID.String()}}, s.users.tokenManager.GetAccessDuration())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return request.TokenRequest{SubjectToken: token, SubjectTokenType: TokenTypeAccessToken}
+			},
+			wantCode: "invalid_grant",
+			wantDesc: "subject_token is bound to a different key",
+		},
+		{
+			name: "impersonation by admin",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.user.GUID.String(), SubjectTokenType: TokenTypeUserGUID, ActorToken: env.adminToken, ActorTokenType: TokenTypeAccessToken, Scope: "read"}
+			},
+			wantActor: "admin",
+			wantAlg:   "HS512",
+		},
+		{
+			name: "impersonation without actor token",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.user.GUID.String(), SubjectTokenType: TokenTypeUserGUID}
+			},
+			wantCode: "invalid_request",
+			wantDesc: "user_guid subject_token requires an admin actor_token",
+		},
+		{
+			name: "impersonation by regular user",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				return request.TokenRequest{SubjectToken: env.admin.GUID.String(), SubjectTokenType: TokenTypeUserGUID, ActorToken: env.userToken, ActorTokenType: TokenTypeAccessToken}
+			},
+			wantCode: "invalid_grant",
+			wantDesc: "actor is not allowed to impersonate users",
+		},
+		{
+			name: "actor token obtained by exchange",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				token, err := s.users.tokenManager.NewAccessTokenWithClaims(auth.CustomClaims{Role: domain.RoleAdmin, Act: &auth.ActorClaims{Subject: "gateway"}, StandardClaims: jwt.StandardClaims{Subject: env.admin.GUID.String()}}, s.users.tokenManager.GetAccessDuration())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return request.TokenRequest{SubjectToken: env.user.GUID.String(), SubjectTokenType: TokenTypeUserGUID, ActorToken: token, ActorTokenType: TokenTypeAccessToken}
+			},
+			wantCode: "invalid_grant",
+			wantDesc: "actor is not allowed to impersonate users",
+		},
+		{
+			name: "actor token issued to a client",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				token, err := s.users.tokenManager.NewAccessTokenWithClaims(auth.CustomClaims{Role: domain.RoleAdmin, ClientID: "gateway", StandardClaims: jwt.StandardClaims{Subject: env.admin.GUID.String()}}, s.users.tokenManager.GetAccessDuration())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return request.TokenRequest{SubjectToken: env.user.GUID.String(), SubjectTokenType: TokenTypeUserGUID, ActorToken: token, ActorTokenType: TokenTypeAccessToken}
+			},
+			wantCode: "invalid_grant",
+			wantDesc: "actor is not allowed to impersonate users",
+		},
+		{
+			name: "impersonation of disabled user",
+			request: func(t *testing.T, s *testOAuthService, env exchangeEnv) request.TokenRequest {
+				s.users.users.users[env.user.GUID].Status = domain.UserStatusDisabled
+				return request.TokenRequest{SubjectToken: env.user.GUID.String(), SubjectTokenType: TokenTypeUserGUID, ActorToken: env.adminToken, ActorTokenType: TokenTypeAccessToken}
+			},
+			wantCode: "invalid_grant",
+			wantDesc: "subject user is not allowed to sign in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestOAuthService(t)
+			env := newExchangeEnv(t, s)
+
+			accessToken, err := s.exchange(tt.request(t, s, env), testClient)
+			if tt.wantCode != "" {
+				var oauthErr *OAuthError
+				if !errors.As(err, &oauthErr) || oauthErr.Code != tt.wantCode || (tt.wantDesc != "" && oauthErr.Description != tt.wantDesc) {
+					t.Fatalf("err = %v, want %s: %s", err, tt.wantCode, tt.wantDesc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := &auth.CustomClaims{}
+			token, _, err := new(jwt.Parser).ParseUnverified(accessToken, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Method.Alg() != tt.wantAlg {
+				t.Errorf("alg = %s, want %s", token.Method.Alg(), tt.wantAlg)
+			}
+			wantActor := map[string]string{"client": "gateway", "admin": env.admin.GUID.String()}[tt.wantActor]
+			if claims.Subject != env.user.GUID.String() || claims.Act == nil || claims.Act.Subject != wantActor || claims.Act.ClientID != "gateway" {
+				t.Errorf("subject %s, act %+v, want act.sub %s", claims.Subject, claims.Act, wantActor)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/payload/request"
+	"JwtTestTask/src/internal/payload/response"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeAdmin разрешает PAT администратора обращаться к /admin/*. Без него токен
+	// администратора получает роль user.
+	ScopeAdmin = "admin"
+
+	// PersonalTokenClientID записывается в claims запросов, аутентифицированных PAT.
+	PersonalTokenClientID = "personal_access_token"
+
+	lastUsedInterval = time.Minute
+)
+
+var personalTokenScopes = map[string]bool{
+	ScopeOpenID: true,
+	ScopeEmail:  true,
+	ScopeAdmin:  true,
+}
+
+type TokenService struct {
+	repo        repository.TokenRepositoryInterface
+	userService *UserService
+}
+
+type TokenServiceInterface interface {
+	Create(claims *auth.CustomClaims, req request.PersonalAccessTokenRequest, client domain.ClientInfo) (response.PersonalAccessTokenResponse, error)
+	List(userGUID string) ([]domain.PersonalAccessToken, error)
+	Revoke(userGUID, id string, client domain.ClientInfo) error
+	Authenticate(token string) (*auth.CustomClaims, error)
+}
+
+func NewTokenService(repo repository.TokenRepositoryInterface, userService *UserService) *TokenService {
+	return &TokenService{repo: repo, userService: userService}
+}
+
+// Create выпускает PAT. Токен возвращается только в ответе, в базе хранится sha256 хеш.
+// Создавать PAT можно только с access token, иначе утёкший PAT или API ключ позволял бы выпускать новые.
+// Отключённые и удалённые пользователи PAT не получают.
+func (s *TokenService) Create(claims *auth.CustomClaims, req request.PersonalAccessTokenRequest, client domain.ClientInfo) (response.PersonalAccessTokenResponse, error) {
+	if claims.ClientID == PersonalTokenClientID {
+		return response.PersonalAccessTokenResponse{}, WithDetail(ErrForbidden, "personal access token cannot create tokens")
+	}
+	if claims.ClientID == APIKeyClientID {
+		return response.PersonalAccessTokenResponse{}, WithDetail(ErrForbidden, "api key cannot create tokens")
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return response.PersonalAccessTokenResponse{}, invalidRequest("name is required")
+	}
+	if req.ExpiresInDays < 0 {
+		return response.PersonalAccessTokenResponse{}, invalidRequest("expires_in_days must not be negative")
+	}
+
+	user, err := s.userService.findUser(claims.Subject)
+	if err != nil {
+		return response.PersonalAccessTokenResponse{}, err
+	}
+	if err := statusError(user); err != nil {
+		return response.PersonalAccessTokenResponse{}, err
+	}
+	for _, scope := range req.Scopes {
+		if !personalTokenScopes[scope] {
+			return response.PersonalAccessTokenResponse{}, invalidRequest("unsupported scope: " + scope)
+		}
+		if scope == ScopeAdmin && user.Role != domain.RoleAdmin {
+			return response.PersonalAccessTokenResponse{}, WithDetail(ErrForbidden, "admin scope requires admin role")
+		}
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return response.PersonalAccessTokenResponse{}, err
+	}
+	token := domain.PersonalAccessTokenPrefix + secret
+
+	now := time.Now()
+	pat := domain.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserGUID:  user.GUID,
+		Name:      req.Name,
+		TokenHash: hashToken(token),
+		Hint:      token[len(token)-4:],
+		Scope:     strings.Join(req.Scopes, " "),
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.Insert(&pat); err != nil {
+		return response.PersonalAccessTokenResponse{}, err
+	}
+
+	s.userService.bus.Publish(event.PersonalTokenCreated{
+		UserGUID:   user.GUID.String(),
+		TokenID:    pat.ID.String(),
+		Scope:      pat.Scope,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: now,
+	})
+
+	return response.PersonalAccessTokenResponse{PersonalAccessToken: pat, Token: token}, nil
+}
+
+func (s *TokenService) List(userGUID string) ([]domain.PersonalAccessToken, error) {
+	guid, err := uuid.Parse(userGUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByUser(guid)
+}
+
+func (s *TokenService) Revoke(userGUID, id string, client domain.ClientInfo) error {
+	guid, err := uuid.Parse(userGUID)
+	if err != nil {
+		return err
+	}
+	tokenID, err := uuid.Parse(id)
+	if err != nil {
+		return WithDetail(ErrNotFound, "token not found")
+	}
+
+	revoked, err := s.repo.Revoke(tokenID, guid, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return WithDetail(ErrNotFound, "token not found")
+	}
+
+	s.userService.bus.Publish(event.PersonalTokenRevoked{
+		UserGUID:   userGUID,
+		TokenID:    id,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: time.Now(),
+	})
+	return nil
+}
+
+// Authenticate проверяет PAT и собирает claims, как если бы пользователь пришёл с access token.
+// Роль и блокировка берутся из базы на каждый запрос, поэтому понижение роли действует сразу.
+func (s *TokenService) Authenticate(token string) (*auth.CustomClaims, error) {
+	pat, err := s.repo.FindByHash(hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	if !pat.IsActive(now) {
+		return nil, WithDetail(ErrTokenExpired, "token expired or revoked")
+	}
+
+	user, err := s.userService.repo.FindByGUID(pat.UserGUID.String())
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := statusError(user); err != nil {
+		return nil, err
+	}
+
+	role := domain.RoleUser
+	if user.Role == domain.RoleAdmin && hasScope(pat.Scope, ScopeAdmin) {
+		role = domain.RoleAdmin
+	}
+
+	if err := s.repo.TouchLastUsed(pat.ID, now, lastUsedInterval); err != nil {
+		return nil, err
+	}
+
+	claims := &auth.CustomClaims{
+		Role:     role,
+		Scope:    pat.Scope,
+		ClientID: PersonalTokenClientID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:  user.GUID.String(),
+			Id:       pat.ID.String(),
+			IssuedAt: pat.CreatedAt.Unix(),
+		},
+	}
+	if pat.ExpiresAt != nil {
+		claims.ExpiresAt = pat.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
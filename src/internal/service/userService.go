@@ -2,109 +2,266 @@ package service
 
 import (
 	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
 	"JwtTestTask/src/internal/payload/response"
 	"JwtTestTask/src/internal/repository"
 	"JwtTestTask/src/pkg/auth"
 	"JwtTestTask/src/pkg/config"
+	"JwtTestTask/src/pkg/logger"
+	"JwtTestTask/src/pkg/mail"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
-	"net/smtp"
+	"gorm.io/gorm"
 	"time"
 )
 
+// emailChangeTTL — сколько действует код подтверждения нового email.
+const emailChangeTTL = 24 * time.Hour
+
 type UserService struct {
 	repo         repository.UserRepositoryInterface
+	sessions     repository.SessionRepositoryInterface
 	tokenManager auth.JwtManagerInterface
+	bus          event.BusInterface
+	lockout      config.LockoutParams
+	mailer       mail.SenderInterface
 }
 
 type UserServiceInterface interface {
-	SignIn(guid string, ip string) (response.JwtResponse, error)
-	SignUp(email string) error
-	RefreshTokens(accessToken string, refreshToken string, currentIp string) (response.JwtResponse, error)
-	sendEmailWarning(email, oldIP, newIP string) error
+	SignIn(guid string, client domain.ClientInfo) (response.JwtResponse, error)
+	SignInSession(guid string, client domain.ClientInfo) (string, error)
+	SignUp(email string, client domain.ClientInfo) error
+	RefreshTokens(accessToken string, refreshToken string, client domain.ClientInfo) (response.JwtResponse, error)
 	GetAll(page, limit int) ([]domain.User, int64, error)
+	List(filter repository.UserFilter, sort repository.UserSort, cursor string, limit int, withTotal bool) ([]domain.User, string, *int64, error)
+	Unlock(guid string, adminGUID string, client domain.ClientInfo) error
+	Get(guid string) (*domain.User, error)
+	ChangeEmail(guid string, email string, actorGUID string, client domain.ClientInfo) (*domain.User, error)
+	RequestEmailChange(guid string, email string, client domain.ClientInfo) (time.Time, error)
+	ConfirmEmailChange(guid string, token string, client domain.ClientInfo) (*domain.User, error)
+	SetStatus(guid string, status string, adminGUID string, client domain.ClientInfo) error
+	StartPurge(interval time.Duration, retention time.Duration)
+	ForceLogout(guid string, adminGUID string, client domain.ClientInfo) error
+	Delete(guid string, actorGUID string, client domain.ClientInfo) error
 }
 
-func NewUserService(repo repository.UserRepositoryInterface, manager auth.JwtManagerInterface) *UserService {
-	return &UserService{repo: repo, tokenManager: manager}
+func NewUserService(repo repository.UserRepositoryInterface, sessions repository.SessionRepositoryInterface, manager auth.JwtManagerInterface, bus event.BusInterface, lockout config.LockoutParams, mailer mail.SenderInterface) *UserService {
+	return &UserService{repo: repo, sessions: sessions, tokenManager: manager, bus: bus, lockout: lockout, mailer: mailer}
 }
 
-func (s *UserService) SignIn(guid string, ip string) (response.JwtResponse, error) {
-
-	user, err := s.repo.FindByGUID(guid)
+func (s *UserService) SignIn(guid string, client domain.ClientInfo) (response.JwtResponse, error) {
+	user, err := s.authenticate(guid, client)
 	if err != nil {
-		return response.JwtResponse{}, fmt.Errorf("user not found")
+		return response.JwtResponse{}, err
 	}
 
-	accessToken, err := s.tokenManager.NewAccessToken(guid, ip)
+	tokens, err := s.issueTokens(user, auth.CustomClaims{IP: client.IP, Cnf: confirmation(client)}, "")
 	if err != nil {
 		return response.JwtResponse{}, err
 	}
-	refreshToken, err := s.tokenManager.NewRefreshToken()
+
+	s.bus.Publish(event.UserSignedIn{UserGUID: guid, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return tokens, nil
+}
+
+// SignInSession выпускает только access token для браузерной сессии сервера авторизации (/login).
+// Refresh сессия не создаётся: обновить такой токен нельзя, по истечении нужно войти заново.
+func (s *UserService) SignInSession(guid string, client domain.ClientInfo) (string, error) {
+	user, err := s.authenticate(guid, client)
 	if err != nil {
-		return response.JwtResponse{}, err
+		return "", err
+	}
+	return s.sessionToken(user, client)
+}
+
+// sessionToken выпускает access token браузерной сессии для уже проверенного пользователя (/login, SSO).
+func (s *UserService) sessionToken(user *domain.User, client domain.ClientInfo) (string, error) {
+	claims := auth.CustomClaims{IP: client.IP, Role: user.Role, StandardClaims: jwt.StandardClaims{Subject: user.GUID.String()}}
+	accessToken, err := s.tokenManager.NewAccessTokenWithClaims(claims, s.tokenManager.GetAccessDuration())
+	if err != nil {
+		return "", err
+	}
+
+	s.bus.Publish(event.UserSignedIn{UserGUID: user.GUID.String(), IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return accessToken, nil
+}
+
+// authenticate проверяет, что пользователь может войти, и публикует SignInFailed, если нет.
+func (s *UserService) authenticate(guid string, client domain.ClientInfo) (*domain.User, error) {
+	user, err := s.findUser(guid)
+	if errors.Is(err, ErrUserNotFound) {
+		s.bus.Publish(event.SignInFailed{UserGUID: guid, IP: client.IP, UserAgent: client.UserAgent, Reason: "user not found", OccurredAt: time.Now()})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := statusError(user); err != nil {
+		s.bus.Publish(event.SignInFailed{UserGUID: guid, IP: client.IP, UserAgent: client.UserAgent, Reason: "account " + user.Status, OccurredAt: time.Now()})
+		return nil, err
 	}
+	return user, nil
+}
 
-	if user.RefreshToken == nil {
-		user.RefreshToken = new(string)
+// issueTokens выпускает новую пару токенов в новой refresh сессии, остальные сессии пользователя
+// не затрагиваются. Subject, роль и sid всегда задаются здесь, остальные claims задаёт вызывающий.
+// Если access token привязан к ключу DPoP или сертификату, к ним же привязывается refresh token.
+// authCodeHash связывает сессию с кодом авторизации, по которому она выдана.
+func (s *UserService) issueTokens(user *domain.User, claims auth.CustomClaims, authCodeHash string) (response.JwtResponse, error) {
+	refreshToken, err := s.tokenManager.NewRefreshToken()
+	if err != nil {
+		return response.JwtResponse{}, err
 	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(refreshToken), bcrypt.DefaultCost)
 	if err != nil {
 		return response.JwtResponse{}, err
 	}
-	*user.RefreshToken = string(hash)
 
-	if user.RefreshTokenExpiry == nil {
-		user.RefreshTokenExpiry = new(time.Time)
+	session := &domain.RefreshSession{
+		ID:           uuid.New(),
+		UserGUID:     user.GUID,
+		ClientID:     claims.ClientID,
+		TokenHash:    string(hash),
+		AuthCodeHash: authCodeHash,
+		ExpiresAt:    time.Now().Add(s.tokenManager.GetRefreshDuration()),
+	}
+	if claims.Cnf != nil {
+		session.JKT, session.X5T = claims.Cnf.JKT, claims.Cnf.X5T
+	}
+	if err := s.sessions.Insert(session); err != nil {
+		return response.JwtResponse{}, err
+	}
+
+	claims.Subject = user.GUID.String()
+	claims.Role = user.Role
+	claims.SessionID = session.ID.String()
+	accessToken, err := s.tokenManager.NewAccessTokenWithClaims(claims, s.tokenManager.GetAccessDuration())
+	if err != nil {
+		return response.JwtResponse{}, err
 	}
-	expiryTime := time.Now().Add(s.tokenManager.GetRefreshDuration())
-	*user.RefreshTokenExpiry = expiryTime
 
-	err = s.repo.UpdateUser(user)
-	tokens := response.JwtResponse{AccessToken: accessToken, RefreshToken: refreshToken}
+	tokens := response.JwtResponse{AccessToken: accessToken, RefreshToken: refreshToken, TokenType: tokenType(claims.Cnf)}
 	return tokens, nil
 }
 
-func (s *UserService) SignUp(email string) error {
+// confirmation возвращает claim cnf для ключа, которым клиент подписал DPoP proof,
+// и для клиентского сертификата соединения.
+func confirmation(client domain.ClientInfo) *auth.Confirmation {
+	if client.DPoPJKT == "" && client.CertThumbprint == "" {
+		return nil
+	}
+	return &auth.Confirmation{JKT: client.DPoPJKT, X5T: client.CertThumbprint}
+}
+
+func tokenType(cnf *auth.Confirmation) string {
+	if cnf != nil && cnf.JKT != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+func (s *UserService) SignUp(email string, client domain.ClientInfo) error {
 	user := domain.User{
-		GUID:               uuid.New(),
-		RefreshToken:       nil,
-		RefreshTokenExpiry: nil,
-		Email:              email,
+		GUID:   uuid.New(),
+		Email:  email,
+		Role:   domain.RoleUser,
+		Status: domain.UserStatusActive,
+	}
+	if err := s.repo.InsertUser(user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrDuplicateEmail
+		}
+		return err
 	}
-	return s.repo.InsertUser(user)
+
+	s.bus.Publish(event.UserSignedUp{UserGUID: user.GUID.String(), Email: email, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return nil
 }
 
-func (s *UserService) RefreshTokens(accessToken string, refreshToken string, currentIp string) (response.JwtResponse, error) {
+func (s *UserService) RefreshTokens(accessToken string, refreshToken string, client domain.ClientInfo) (response.JwtResponse, error) {
 	claims, err := s.tokenManager.Parse(accessToken)
+	if err != nil {
+		s.refreshFailed("", client, "invalid access token")
+		return response.JwtResponse{}, WithDetail(ErrInvalidToken, err.Error())
+	}
+
+	user, err := s.findUser(claims.Subject)
+	if errors.Is(err, ErrUserNotFound) {
+		s.refreshFailed(claims.Subject, client, "user not found")
+	}
 	if err != nil {
 		return response.JwtResponse{}, err
 	}
 
-	user, err := s.repo.FindByGUID(claims.Subject)
+	if err := statusError(user); err != nil {
+		s.refreshFailed(claims.Subject, client, "account "+user.Status)
+		return response.JwtResponse{}, err
+	}
+	session, err := s.findSession(claims, user)
+	if errors.Is(err, ErrInvalidToken) {
+		s.refreshFailed(claims.Subject, client, "refresh session not found")
+	}
 	if err != nil {
-		return response.JwtResponse{}, errors.New("user not found")
+		return response.JwtResponse{}, err
+	}
+	if session.IsExpired(time.Now()) {
+		s.refreshFailed(claims.Subject, client, "refresh token expired")
+		return response.JwtResponse{}, WithDetail(ErrTokenExpired, "refresh token expired")
+	}
+	if session.IsLocked(time.Now()) {
+		s.refreshFailed(claims.Subject, client, "session locked")
+		return response.JwtResponse{}, lockedError(session)
 	}
 
-	if user.RefreshTokenExpiry == nil || time.Now().After(*user.RefreshTokenExpiry) {
-		return response.JwtResponse{}, fmt.Errorf("refresh token expired")
+	if bcrypt.CompareHashAndPassword([]byte(session.TokenHash), []byte(refreshToken)) != nil {
+		s.refreshFailed(claims.Subject, client, "invalid refresh token")
+		if err := s.registerFailedAttempt(user, session, client); err != nil {
+			return response.JwtResponse{}, err
+		}
+		return response.JwtResponse{}, WithDetail(ErrInvalidToken, "invalid refresh token")
 	}
 
-	if user.RefreshToken == nil || bcrypt.CompareHashAndPassword([]byte(*user.RefreshToken), []byte(refreshToken)) != nil {
-		return response.JwtResponse{}, errors.New("invalid refresh token")
+	// Привязанный refresh token без proof того же ключа бесполезен для укравшего его.
+	if session.JKT != "" && session.JKT != client.DPoPJKT {
+		s.refreshFailed(claims.Subject, client, "dpop key mismatch")
+		return response.JwtResponse{}, WithDetail(ErrTokenBinding, "dpop proof with the bound key is required")
+	}
+	if session.X5T != "" && session.X5T != client.CertThumbprint {
+		s.refreshFailed(claims.Subject, client, "client certificate mismatch")
+		return response.JwtResponse{}, WithDetail(ErrTokenBinding, "refresh token is bound to a different client certificate")
 	}
 
-	if claims.IP != currentIp {
-		err := s.sendEmailWarning(user.Email, claims.IP, currentIp)
+	if claims.IP != client.IP {
+		err := s.revokeSession(session, client, "ip_changed")
 		if err != nil {
 			return response.JwtResponse{}, err
 		}
-		return response.JwtResponse{}, fmt.Errorf("invalid ip. Email warning")
+		s.bus.Publish(event.SuspiciousIPDetected{
+			UserGUID:   claims.Subject,
+			Email:      user.Email,
+			OldIP:      claims.IP,
+			NewIP:      client.IP,
+			UserAgent:  client.UserAgent,
+			OccurredAt: time.Now(),
+		})
+		return response.JwtResponse{}, WithDetail(ErrIPMismatch, "ip address changed, session revoked and owner notified by email")
 	}
 
-	newAccessToken, err := s.tokenManager.NewAccessToken(claims.Subject, claims.IP)
+	newClaims := auth.CustomClaims{
+		IP:             claims.IP,
+		Role:           user.Role,
+		Scope:          claims.Scope,
+		ClientID:       claims.ClientID,
+		Cnf:            confirmation(client),
+		SessionID:      session.ID.String(),
+		StandardClaims: jwt.StandardClaims{Subject: claims.Subject},
+	}
+	newAccessToken, err := s.tokenManager.NewAccessTokenWithClaims(newClaims, s.tokenManager.GetAccessDuration())
 	if err != nil {
 		return response.JwtResponse{}, err
 	}
@@ -119,61 +276,382 @@ func (s *UserService) RefreshTokens(accessToken string, refreshToken string, cur
 		return response.JwtResponse{}, err
 	}
 
-	if user.RefreshToken == nil {
-		user.RefreshToken = new(string)
-	}
-	*user.RefreshToken = string(hash)
-
-	err = s.repo.UpdateUser(user)
+	rotated, err := s.sessions.Rotate(session.ID, session.TokenHash, string(hash), client.DPoPJKT, client.CertThumbprint)
 	if err != nil {
 		return response.JwtResponse{}, err
 	}
+	if !rotated {
+		s.refreshFailed(claims.Subject, client, "refresh token already used")
+		return response.JwtResponse{}, WithDetail(ErrInvalidToken, "refresh token already used")
+	}
 
-	tokens := response.JwtResponse{AccessToken: newAccessToken, RefreshToken: newRefreshToken}
+	s.bus.Publish(event.TokenRefreshed{UserGUID: claims.Subject, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+
+	tokens := response.JwtResponse{AccessToken: newAccessToken, RefreshToken: newRefreshToken, TokenType: tokenType(newClaims.Cnf)}
 	return tokens, nil
 }
 
-func (s *UserService) sendEmailWarning(email, oldIP, newIP string) error {
-	err := s.logout(email)
+// findSession возвращает refresh сессию, в которой выдан access token. Токены без sid (браузерная
+// сессия /login, обмен токенов) и токены отозванных сессий обновить нельзя.
+func (s *UserService) findSession(claims *auth.CustomClaims, user *domain.User) (*domain.RefreshSession, error) {
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, WithDetail(ErrInvalidToken, "access token has no refresh session")
+	}
+	session, err := s.sessions.Find(sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && session.UserGUID != user.GUID) {
+		return nil, WithDetail(ErrInvalidToken, "refresh session revoked")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *UserService) refreshFailed(guid string, client domain.ClientInfo, reason string) {
+	s.bus.Publish(event.TokenRefreshFailed{UserGUID: guid, IP: client.IP, UserAgent: client.UserAgent, Reason: reason, OccurredAt: time.Now()})
+}
+
+// registerFailedAttempt блокирует refresh сессию после LockoutParams.MaxAttempts неудачных попыток.
+// Счётчики ведутся по сессии, а не по GUID, и ничего не отзывается: иначе любой, кто знает GUID
+// пользователя, мог бы завершить все его сессии. Остальные сессии пользователя работают как прежде.
+// Каждая следующая блокировка вдвое длиннее предыдущей, но не дольше MaxDuration. Успешное обновление
+// счётчик блокировок не сбрасывает: он обнуляется, только если с конца последней блокировки прошло
+// MaxDuration без новых блокировок, или администратором через Unlock.
+func (s *UserService) registerFailedAttempt(user *domain.User, session *domain.RefreshSession, client domain.ClientInfo) error {
+	now := time.Now()
+	if session.LockedUntil != nil && now.Sub(*session.LockedUntil) >= s.lockout.MaxDuration {
+		session.LockoutCount = 0
+	}
+
+	session.FailedAttempts++
+	if session.FailedAttempts < s.lockout.MaxAttempts {
+		return s.sessions.UpdateLockout(session)
+	}
+
+	session.FailedAttempts = 0
+	session.LockoutCount++
+	duration := s.lockout.BaseDuration
+	for i := 1; i < session.LockoutCount && duration < s.lockout.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > s.lockout.MaxDuration {
+		duration = s.lockout.MaxDuration
+	}
+	lockedUntil := now.Add(duration)
+	session.LockedUntil = &lockedUntil
+	if err := s.sessions.UpdateLockout(session); err != nil {
+		return err
+	}
+
+	s.bus.Publish(event.AccountLocked{
+		UserGUID:    user.GUID.String(),
+		SessionID:   session.ID.String(),
+		Email:       user.Email,
+		LockedUntil: lockedUntil,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		OccurredAt:  time.Now(),
+	})
+	return nil
+}
+
+func (s *UserService) Unlock(guid string, adminGUID string, client domain.ClientInfo) error {
+	user, err := s.findUser(guid)
 	if err != nil {
 		return err
 	}
-	subject := "IP Address Change Warning"
-	body := "Your IP address has changed from " + oldIP + " to " + newIP + "."
-	message := []byte("Subject: " + subject + "\n\n" + body)
 
-	smtpParams := config.GetSmtpParams()
+	if _, err := s.sessions.UnlockByUser(user.GUID); err != nil {
+		return err
+	}
+
+	s.bus.Publish(event.AccountUnlocked{UserGUID: guid, AdminGUID: adminGUID, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return nil
+}
+
+func (s *UserService) Get(guid string) (*domain.User, error) {
+	return s.findUser(guid)
+}
+
+func (s *UserService) ChangeEmail(guid string, email string, actorGUID string, client domain.ClientInfo) (*domain.User, error) {
+	user, err := s.findUser(guid)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email == email {
+		return user, nil
+	}
+
+	if err := s.repo.UpdateEmail(user.GUID, email); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, s.updateError(guid, err)
+	}
+
+	oldEmail := user.Email
+	user.Email = email
+	user.EmailVerified = false
+	s.bus.Publish(event.EmailChanged{UserGUID: guid, ActorGUID: actorGUID, OldEmail: oldEmail, NewEmail: email, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return user, nil
+}
+
+// RequestEmailChange запоминает новый адрес и отправляет на него код подтверждения, старый адрес получает
+// уведомление. Email меняется только после ConfirmEmailChange, повторный запрос заменяет предыдущий.
+func (s *UserService) RequestEmailChange(guid string, email string, client domain.ClientInfo) (time.Time, error) {
+	user, err := s.findUser(guid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user.Email == email {
+		return time.Time{}, invalidRequest("email is unchanged")
+	}
+	if _, err := s.repo.FindByEmail(email); err == nil {
+		return time.Time{}, ErrDuplicateEmail
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, err
+	}
+
+	token, err := randomString(32)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiresAt := time.Now().Add(emailChangeTTL)
+	if err := s.repo.SetPendingEmail(user.GUID, email, hashToken(token), expiresAt); err != nil {
+		return time.Time{}, s.updateError(guid, err)
+	}
+
+	// Код отправляется напрямую, а не через шину: подписчики (журнал, webhook) не должны его видеть.
+	body := "Use this code to confirm your new email address: " + token +
+		"\nThe code expires at " + expiresAt.UTC().Format(time.RFC1123) + "."
+	if err := s.mailer.Send(email, "Confirm Email Change", body); err != nil {
+		return time.Time{}, err
+	}
+
+	s.bus.Publish(event.EmailChangeRequested{
+		UserGUID:   guid,
+		OldEmail:   user.Email,
+		NewEmail:   email,
+		ExpiresAt:  expiresAt,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		OccurredAt: time.Now(),
+	})
+	return expiresAt, nil
+}
+
+// ConfirmEmailChange применяет запрошенную смену email по коду из письма. Новый адрес считается подтверждённым.
+func (s *UserService) ConfirmEmailChange(guid string, token string, client domain.ClientInfo) (*domain.User, error) {
+	user, err := s.findUser(guid)
+	if err != nil {
+		return nil, err
+	}
+	if user.PendingEmail == "" || user.EmailChangeExpiry == nil || time.Now().After(*user.EmailChangeExpiry) ||
+		subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(user.EmailChangeTokenHash)) != 1 {
+		return nil, invalidRequest("invalid or expired verification code")
+	}
+
+	if err := s.repo.ConfirmEmail(user.GUID, user.PendingEmail); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, s.updateError(guid, err)
+	}
+
+	oldEmail := user.Email
+	user.Email, user.EmailVerified = user.PendingEmail, true
+	user.PendingEmail, user.EmailChangeTokenHash, user.EmailChangeExpiry = "", "", nil
+	s.bus.Publish(event.EmailChanged{UserGUID: guid, ActorGUID: guid, OldEmail: oldEmail, NewEmail: user.Email, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return user, nil
+}
+
+// SetStatus переводит учётную запись в active или disabled. Отключённый пользователь теряет refresh сессии
+// и не может войти, пока его не включат обратно. Включение активирует и учётные записи в статусе pending.
+func (s *UserService) SetStatus(guid string, status string, adminGUID string, client domain.ClientInfo) error {
+	if status != domain.UserStatusActive && status != domain.UserStatusDisabled {
+		return invalidRequest("unsupported status: " + status)
+	}
+	if status == domain.UserStatusDisabled && guid == adminGUID {
+		return WithDetail(ErrForbidden, "cannot disable own account")
+	}
+	user, err := s.findUser(guid)
+	if err != nil {
+		return err
+	}
+	if user.Status == status {
+		return nil
+	}
 
-	from := smtpParams.Username
-	user := smtpParams.Username
-	password := smtpParams.Password
-	to := []string{email}
+	if err := s.repo.SetStatus(user.GUID, status); err != nil {
+		return s.updateError(guid, err)
+	}
 
-	addr := smtpParams.Host + ":" + smtpParams.Port
-	host := smtpParams.Host
+	if status == domain.UserStatusDisabled {
+		s.bus.Publish(event.AccountDisabled{UserGUID: guid, AdminGUID: adminGUID, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	} else {
+		s.bus.Publish(event.AccountEnabled{UserGUID: guid, AdminGUID: adminGUID, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	}
+	return nil
+}
 
-	plainAuth := smtp.PlainAuth("", user, password, host)
-	err = smtp.SendMail(addr, plainAuth, from, to, message)
+// ForceLogout отзывает все refresh сессии пользователя. Уже выданные access token действуют до истечения срока.
+func (s *UserService) ForceLogout(guid string, adminGUID string, client domain.ClientInfo) error {
+	user, err := s.findUser(guid)
 	if err != nil {
 		return err
 	}
 
+	if _, err := s.sessions.DeleteByUser(user.GUID); err != nil {
+		return err
+	}
+
+	s.bus.Publish(event.UserLoggedOut{UserGUID: guid, IP: client.IP, UserAgent: client.UserAgent, Reason: "forced by " + adminGUID, OccurredAt: time.Now()})
 	return nil
 }
 
-func (s *UserService) logout(email string) error {
-	user, err := s.repo.FindByEmail(email)
+// Delete мягко удаляет пользователя. Данные удаляются окончательно через период хранения, см. StartPurge.
+func (s *UserService) Delete(guid string, actorGUID string, client domain.ClientInfo) error {
+	user, err := s.findUser(guid)
 	if err != nil {
-		return errors.New("user not found")
+		return err
+	}
+
+	if err := s.repo.DeleteUser(user.GUID); err != nil {
+		return err
+	}
+
+	s.bus.Publish(event.UserDeleted{UserGUID: guid, ActorGUID: actorGUID, Email: user.Email, IP: client.IP, UserAgent: client.UserAgent, OccurredAt: time.Now()})
+	return nil
+}
+
+func (s *UserService) revokeSession(session *domain.RefreshSession, client domain.ClientInfo, reason string) error {
+	if _, err := s.sessions.Delete(session.ID); err != nil {
+		return err
 	}
-	*user.RefreshToken = ""
-	err = s.repo.UpdateUser(user)
+
+	s.bus.Publish(event.UserLoggedOut{UserGUID: session.UserGUID.String(), IP: client.IP, UserAgent: client.UserAgent, Reason: reason, OccurredAt: time.Now()})
+	return nil
+}
+
+// revokeClientSessions отзывает сессии пользователя у одного OAuth клиента, сессии других клиентов остаются.
+func (s *UserService) revokeClientSessions(user *domain.User, clientID string, client domain.ClientInfo, reason string) error {
+	if _, err := s.sessions.DeleteByClient(user.GUID, clientID); err != nil {
+		return err
+	}
+
+	s.bus.Publish(event.UserLoggedOut{UserGUID: user.GUID.String(), IP: client.IP, UserAgent: client.UserAgent, Reason: reason, OccurredAt: time.Now()})
+	return nil
+}
+
+// revokeCodeSessions отзывает сессии, выданные по коду авторизации (повторное предъявление кода, RFC 6749, 4.1.2).
+func (s *UserService) revokeCodeSessions(userGUID string, codeHash string, client domain.ClientInfo) error {
+	revoked, err := s.sessions.DeleteByAuthCode(codeHash)
 	if err != nil {
 		return err
 	}
+	if revoked > 0 {
+		s.bus.Publish(event.UserLoggedOut{UserGUID: userGUID, IP: client.IP, UserAgent: client.UserAgent, Reason: "authorization code reuse", OccurredAt: time.Now()})
+	}
 	return nil
 }
 
 func (s *UserService) GetAll(page, limit int) ([]domain.User, int64, error) {
 	return s.repo.GetAll(page, limit)
 }
+
+// List возвращает страницу пользователей и курсор следующей страницы. Общее число считается
+// отдельным запросом только при withTotal: на больших таблицах COUNT дороже самой выборки.
+func (s *UserService) List(filter repository.UserFilter, sort repository.UserSort, cursor string, limit int, withTotal bool) ([]domain.User, string, *int64, error) {
+	after, err := decodeUserCursor(cursor, sort)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	users, err := s.repo.Find(filter, sort, after, limit)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var total *int64
+	if withTotal {
+		count, err := s.repo.Count(filter)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		total = &count
+	}
+
+	nextCursor := ""
+	if len(users) == limit {
+		nextCursor = encodeUserCursor(users[len(users)-1], sort)
+	}
+	return users, nextCursor, total, nil
+}
+
+// userCursor привязан к сортировке: курсор, полученный при другой сортировке, отклоняется.
+type userCursor struct {
+	Sort  string    `json:"s"`
+	Desc  bool      `json:"d"`
+	Value string    `json:"v"`
+	GUID  uuid.UUID `json:"g"`
+}
+
+func encodeUserCursor(user domain.User, sort repository.UserSort) string {
+	cursor := userCursor{Sort: sort.Field, Desc: sort.Desc, Value: user.Email, GUID: user.GUID}
+	if sort.Field == repository.UserSortCreatedAt {
+		cursor.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeUserCursor(cursor string, sort repository.UserSort) (*repository.UserCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidRequest("invalid cursor")
+	}
+	var decoded userCursor
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, invalidRequest("invalid cursor")
+	}
+	if decoded.Sort != sort.Field || decoded.Desc != sort.Desc {
+		return nil, invalidRequest("cursor does not match sort")
+	}
+	if decoded.Sort == repository.UserSortCreatedAt {
+		if _, err := time.Parse(time.RFC3339Nano, decoded.Value); err != nil {
+			return nil, invalidRequest("invalid cursor")
+		}
+	}
+	return &repository.UserCursor{Value: decoded.Value, GUID: decoded.GUID}, nil
+}
+
+// StartPurge раз в interval окончательно удаляет пользователей, мягко удалённых дольше retention назад,
+// и истёкшие refresh сессии.
+func (s *UserService) StartPurge(interval time.Duration, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.purge(retention)
+		}
+	}()
+}
+
+func (s *UserService) purge(retention time.Duration) {
+	purged, err := s.repo.PurgeDeleted(time.Now().Add(-retention))
+	if err != nil {
+		logger.Log.Errorf("Ошибка окончательного удаления пользователей: %v", err)
+		return
+	}
+	if purged > 0 {
+		logger.Log.Infof("Окончательно удалено пользователей: %d", purged)
+	}
+	if _, err := s.sessions.DeleteExpired(time.Now()); err != nil {
+		logger.Log.Errorf("Ошибка удаления истёкших сессий: %v", err)
+	}
+}
@@ -0,0 +1,657 @@
+package service
+
+import (
+	"JwtTestTask/src/internal/domain"
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/internal/repository"
+	"JwtTestTask/src/pkg/auth"
+	"JwtTestTask/src/pkg/logger"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"io"
+	"testing"
+	"time"
+)
+
+var testClient = domain.ClientInfo{IP: "10.0.0.1", UserAgent: "test"}
+
+func sessionID(t *testing.T, s *testUserService, accessToken string) uuid.UUID {
+	t.Helper()
+	claims, err := s.tokenManager.Parse(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uuid.MustParse(claims.SessionID)
+}
+
+func TestRefreshLockoutEscalation(t *testing.T) {
+	tests := []struct {
+		name         string
+		lockoutCount int
+		lockedAgo    time.Duration
+		attempts     int
+		wantCount    int
+		wantDuration time.Duration
+	}{
+		{name: "below threshold", attempts: 2},
+		{name: "first lockout", attempts: 3, wantCount: 1, wantDuration: 15 * time.Minute},
+		{name: "second lockout doubles", lockoutCount: 1, lockedAgo: time.Minute, attempts: 3, wantCount: 2, wantDuration: 30 * time.Minute},
+		{name: "capped at max duration", lockoutCount: 2, lockedAgo: time.Minute, attempts: 3, wantCount: 3, wantDuration: 40 * time.Minute},
+		{name: "count reset after quiet period", lockoutCount: 2, lockedAgo: 41 * time.Minute, attempts: 3, wantCount: 1, wantDuration: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			user := s.addUser(t, domain.RoleUser)
+			tokens, err := s.SignIn(user.GUID.String(), testClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := sessionID(t, s, tokens.AccessToken)
+			if tt.lockoutCount > 0 {
+				lockedUntil := time.Now().Add(-tt.lockedAgo)
+				s.sessions.sessions[id] = func(session domain.RefreshSession) domain.RefreshSession {
+					session.LockoutCount, session.LockedUntil = tt.lockoutCount, &lockedUntil
+					return session
+				}(s.sessions.sessions[id])
+			}
+
+			start := time.Now()
+			for i := 0; i < tt.attempts; i++ {
+				if _, err := s.RefreshTokens(tokens.AccessToken, "wrong", testClient); !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("attempt %d: err = %v, want invalid token", i+1, err)
+				}
+			}
+
+			session, err := s.sessions.Find(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			locked := s.events.named(event.AccountLockedName)
+			if tt.wantDuration == 0 {
+				if session.IsLocked(time.Now()) || len(locked) != 0 || session.FailedAttempts != tt.attempts {
+					t.Fatalf("unexpected lockout: %+v, events %d", session, len(locked))
+				}
+				return
+			}
+
+			if session.LockoutCount != tt.wantCount || session.FailedAttempts != 0 {
+				t.Errorf("lockout count = %d, failed attempts = %d, want %d, 0", session.LockoutCount, session.FailedAttempts, tt.wantCount)
+			}
+			if session.LockedUntil == nil || session.LockedUntil.Before(start.Add(tt.wantDuration)) || session.LockedUntil.After(time.Now().Add(tt.wantDuration)) {
+				t.Errorf("locked until %v, want %v from now", session.LockedUntil, tt.wantDuration)
+			}
+			if len(locked) != 1 || locked[0].(event.AccountLocked).SessionID != id.String() {
+				t.Errorf("account locked events = %+v, want one for session %s", locked, id)
+			}
+		})
+	}
+}
+
+func TestLockedSessionDoesNotAffectOtherSessions(t *testing.T) {
+	s := newTestUserService(t)
+	user := s.addUser(t, domain.RoleUser)
+	attacked, err := s.SignIn(user.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.SignIn(user.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < testLockout.MaxAttempts; i++ {
+		_, _ = s.RefreshTokens(attacked.AccessToken, "wrong", testClient)
+	}
+
+	if _, err := s.RefreshTokens(attacked.AccessToken, attacked.RefreshToken, testClient); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("locked session: err = %v, want account locked", err)
+	}
+	if len(s.sessions.sessions) != 2 {
+		t.Fatalf("sessions = %d, lockout must not revoke anything", len(s.sessions.sessions))
+	}
+	if _, err := s.RefreshTokens(other.AccessToken, other.RefreshToken, testClient); err != nil {
+		t.Fatalf("other session: %v", err)
+	}
+
+	if err := s.Unlock(user.GUID.String(), uuid.NewString(), testClient); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RefreshTokens(attacked.AccessToken, attacked.RefreshToken, testClient); err != nil {
+		t.Fatalf("after unlock: %v", err)
+	}
+}
+
+func TestRefreshTokensRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		prepare   func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo)
+		wantErr   error
+		wantEvent string
+	}{
+		{
+			name: "malformed access token",
+			prepare: func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo) {
+				return accessToken + "x", testClient
+			},
+			wantErr:   ErrInvalidToken,
+			wantEvent: event.TokenRefreshFailedName,
+		},
+		{
+			name: "access token without refresh session",
+			prepare: func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo) {
+				sessionToken, err := s.sessionToken(user, testClient)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sessionToken, testClient
+			},
+			wantErr:   ErrInvalidToken,
+			wantEvent: event.TokenRefreshFailedName,
+		},
+		{
+			name: "revoked session",
+			prepare: func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo) {
+				delete(s.sessions.sessions, sessionID(t, s, accessToken))
+				return accessToken, testClient
+			},
+			wantErr:   ErrInvalidToken,
+			wantEvent: event.TokenRefreshFailedName,
+		},
+		{
+			name: "expired session",
+			prepare: func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo) {
+				id := sessionID(t, s, accessToken)
+				session := s.sessions.sessions[id]
+				session.ExpiresAt = time.Now().Add(-time.Second)
+				s.sessions.sessions[id] = session
+				return accessToken, testClient
+			},
+			wantErr:   ErrTokenExpired,
+			wantEvent: event.TokenRefreshFailedName,
+		},
+		{
+			name: "disabled user",
+			prepare: func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo) {
+				s.users.users[user.GUID].Status = domain.UserStatusDisabled
+				return accessToken, testClient
+			},
+			wantErr:   ErrAccountDisabled,
+			wantEvent: event.TokenRefreshFailedName,
+		},
+		{
+			name: "ip changed",
+			prepare: func(t *testing.T, s *testUserService, user *domain.User, accessToken string) (string, domain.ClientInfo) {
+				return accessToken, domain.ClientInfo{IP: "10.0.0.9", UserAgent: "test"}
+			},
+			wantErr:   ErrIPMismatch,
+			wantEvent: event.SuspiciousIPDetectedName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			user := s.addUser(t, domain.RoleUser)
+			tokens, err := s.SignIn(user.GUID.String(), testClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			accessToken, client := tt.prepare(t, s, user, tokens.AccessToken)
+
+			if _, err := s.RefreshTokens(accessToken, tokens.RefreshToken, client); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(s.events.named(tt.wantEvent)) != 1 {
+				t.Errorf("%s was not published", tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestUserService(t)
+	user := s.addUser(t, domain.RoleUser)
+	first, err := s.SignIn(user.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.RefreshTokens(first.AccessToken, first.RefreshToken, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken || sessionID(t, s, second.AccessToken) != sessionID(t, s, first.AccessToken) {
+		t.Fatal("refresh must rotate the token within the same session")
+	}
+	if _, err := s.RefreshTokens(first.AccessToken, first.RefreshToken, testClient); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("reused refresh token: err = %v, want invalid token", err)
+	}
+	if _, err := s.RefreshTokens(second.AccessToken, second.RefreshToken, testClient); err != nil {
+		t.Fatalf("rotated refresh token: %v", err)
+	}
+}
+
+func TestConcurrentRefreshSucceedsOnce(t *testing.T) {
+	s := newTestUserService(t)
+	user := s.addUser(t, domain.RoleUser)
+	tokens, err := s.SignIn(user.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const attempts = 4
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			_, err := s.RefreshTokens(tokens.AccessToken, tokens.RefreshToken, testClient)
+			results <- err
+		}()
+	}
+
+	succeeded := 0
+	for i := 0; i < attempts; i++ {
+		err := <-results
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("refresh succeeded %d times, want exactly once", succeeded)
+	}
+}
+
+func TestRefreshTokenBinding(t *testing.T) {
+	tests := []struct {
+		name          string
+		signInClient  domain.ClientInfo
+		refreshClient domain.ClientInfo
+		wantErr       error
+		wantTokenType string
+	}{
+		{name: "unbound session", signInClient: testClient, refreshClient: testClient, wantTokenType: "Bearer"},
+		{
+			name:          "dpop proof with the bound key",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-1"},
+			refreshClient: domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-1"},
+			wantTokenType: "DPoP",
+		},
+		{
+			name:          "dpop bound session without proof",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-1"},
+			refreshClient: testClient,
+			wantErr:       ErrTokenBinding,
+		},
+		{
+			name:          "dpop proof with another key",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-1"},
+			refreshClient: domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-2"},
+			wantErr:       ErrTokenBinding,
+		},
+		{
+			name:          "same client certificate",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, CertThumbprint: "cert-1"},
+			refreshClient: domain.ClientInfo{IP: testClient.IP, CertThumbprint: "cert-1"},
+			wantTokenType: "Bearer",
+		},
+		{
+			name:          "certificate bound session without certificate",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, CertThumbprint: "cert-1"},
+			refreshClient: testClient,
+			wantErr:       ErrTokenBinding,
+		},
+		{
+			name:          "another client certificate",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, CertThumbprint: "cert-1"},
+			refreshClient: domain.ClientInfo{IP: testClient.IP, CertThumbprint: "cert-2"},
+			wantErr:       ErrTokenBinding,
+		},
+		{
+			name:          "dpop and certificate together",
+			signInClient:  domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-1", CertThumbprint: "cert-1"},
+			refreshClient: domain.ClientInfo{IP: testClient.IP, DPoPJKT: "key-1", CertThumbprint: "cert-2"},
+			wantErr:       ErrTokenBinding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			user := s.addUser(t, domain.RoleUser)
+			tokens, err := s.SignIn(user.GUID.String(), tt.signInClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refreshed, err := s.RefreshTokens(tokens.AccessToken, tokens.RefreshToken, tt.refreshClient)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshed.TokenType != tt.wantTokenType {
+				t.Errorf("token type = %s, want %s", refreshed.TokenType, tt.wantTokenType)
+			}
+			claims, err := s.tokenManager.Parse(refreshed.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cnf := confirmation(tt.refreshClient); (cnf == nil) != (claims.Cnf == nil) || (cnf != nil && *cnf != *claims.Cnf) {
+				t.Errorf("cnf = %+v, want %+v", claims.Cnf, cnf)
+			}
+		})
+	}
+}
+
+func TestDecodeUserCursor(t *testing.T) {
+	byEmail := repository.UserSort{Field: repository.UserSortEmail}
+	byCreatedDesc := repository.UserSort{Field: repository.UserSortCreatedAt, Desc: true}
+	user := domain.User{GUID: uuid.New(), Email: "a@example.com", CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC)}
+	encode := func(cursor userCursor) string {
+		raw, err := json.Marshal(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	tests := []struct {
+		name      string
+		cursor    string
+		sort      repository.UserSort
+		want      *repository.UserCursor
+		wantError string
+	}{
+		{name: "empty cursor", sort: byEmail},
+		{name: "email cursor", cursor: encodeUserCursor(user, byEmail), sort: byEmail, want: &repository.UserCursor{Value: user.Email, GUID: user.GUID}},
+		{
+			name:   "created_at cursor",
+			cursor: encodeUserCursor(user, byCreatedDesc),
+			sort:   byCreatedDesc,
+			want:   &repository.UserCursor{Value: "2024-05-01T10:00:00.123456Z", GUID: user.GUID},
+		},
+		{name: "not base64", cursor: "!!!", sort: byEmail, wantError: "invalid cursor"},
+		{name: "not json", cursor: base64.RawURLEncoding.EncodeToString([]byte("email")), sort: byEmail, wantError: "invalid cursor"},
+		{name: "other sort field", cursor: encodeUserCursor(user, byEmail), sort: repository.UserSort{Field: repository.UserSortCreatedAt}, wantError: "cursor does not match sort"},
+		{name: "other direction", cursor: encodeUserCursor(user, byEmail), sort: repository.UserSort{Field: repository.UserSortEmail, Desc: true}, wantError: "cursor does not match sort"},
+		{
+			name:      "invalid created_at",
+			cursor:    encode(userCursor{Sort: repository.UserSortCreatedAt, Desc: true, Value: "yesterday", GUID: user.GUID}),
+			sort:      byCreatedDesc,
+			wantError: "invalid cursor",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeUserCursor(tt.cursor, tt.sort)
+			if tt.wantError != "" {
+				if !errors.Is(err, ErrInvalidRequest) || err.Error() != tt.wantError {
+					t.Fatalf("err = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("cursor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListPaginatesWithoutGapsOrDuplicates(t *testing.T) {
+	s := newTestUserService(t)
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		user := domain.User{
+			GUID:      uuid.New(),
+			Email:     fmt.Sprintf("user%d@example.com", 7-i),
+			Role:      domain.RoleUser,
+			Status:    domain.UserStatusActive,
+			CreatedAt: base.Add(time.Duration(i/2) * time.Minute), // по два пользователя с одинаковым created_at
+		}
+		if err := s.users.InsertUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		sort repository.UserSort
+	}{
+		{name: "email ascending", sort: repository.UserSort{Field: repository.UserSortEmail}},
+		{name: "email descending", sort: repository.UserSort{Field: repository.UserSortEmail, Desc: true}},
+		{name: "created_at ascending with ties", sort: repository.UserSort{Field: repository.UserSortCreatedAt}},
+		{name: "created_at descending with ties", sort: repository.UserSort{Field: repository.UserSortCreatedAt, Desc: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := s.users.Find(repository.UserFilter{}, tt.sort, nil, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []domain.User
+			cursor := ""
+			for page := 0; page < 10; page++ {
+				users, next, total, err := s.List(repository.UserFilter{}, tt.sort, cursor, 3, page == 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (total != nil) != (page == 0) || (total != nil && *total != 7) {
+					t.Errorf("page %d: total = %v", page, total)
+				}
+				got = append(got, users...)
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("paged %d users, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].GUID != want[i].GUID {
+					t.Fatalf("position %d: %s, want %s", i, got[i].Email, want[i].Email)
+				}
+			}
+		})
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		initial      string
+		deleted      bool
+		self         bool
+		status       string
+		wantErr      error
+		wantEvent    string
+		wantSessions int
+	}{
+		{name: "disable active user", initial: domain.UserStatusActive, status: domain.UserStatusDisabled, wantEvent: event.AccountDisabledName},
+		{name: "enable disabled user", initial: domain.UserStatusDisabled, status: domain.UserStatusActive, wantEvent: event.AccountEnabledName, wantSessions: 1},
+		{name: "unchanged status", initial: domain.UserStatusActive, status: domain.UserStatusActive, wantSessions: 1},
+		{name: "deleted is not a status", initial: domain.UserStatusActive, status: domain.UserStatusDeleted, wantErr: ErrInvalidRequest, wantSessions: 1},
+		{name: "disable own account", initial: domain.UserStatusActive, self: true, status: domain.UserStatusDisabled, wantErr: ErrForbidden, wantSessions: 1},
+		{name: "soft-deleted user", initial: domain.UserStatusActive, deleted: true, status: domain.UserStatusDisabled, wantErr: ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			user := s.addUser(t, domain.RoleUser)
+			if _, err := s.issueTokens(user, auth.CustomClaims{IP: testClient.IP}, ""); err != nil {
+				t.Fatal(err)
+			}
+			s.users.users[user.GUID].Status = tt.initial
+			if tt.deleted {
+				if err := s.users.DeleteUser(user.GUID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			adminGUID := uuid.NewString()
+			if tt.self {
+				adminGUID = user.GUID.String()
+			}
+
+			if err := s.SetStatus(user.GUID.String(), tt.status, adminGUID, testClient); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantEvent != "" && len(s.events.named(tt.wantEvent)) != 1 {
+				t.Errorf("%s was not published", tt.wantEvent)
+			}
+			if tt.wantEvent == "" && len(s.events.events) != 0 {
+				t.Errorf("unexpected events: %+v", s.events.events)
+			}
+			if len(s.sessions.sessions) != tt.wantSessions {
+				t.Errorf("sessions = %d, want %d", len(s.sessions.sessions), tt.wantSessions)
+			}
+		})
+	}
+}
+
+func TestDeleteIsSoft(t *testing.T) {
+	s := newTestUserService(t)
+	user := s.addUser(t, domain.RoleUser)
+	tokens, err := s.SignIn(user.GUID.String(), testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete(user.GUID.String(), user.GUID.String(), testClient); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.events.named(event.UserDeletedName)) != 1 {
+		t.Error("user deletion was not published")
+	}
+	if _, ok := s.users.users[user.GUID]; !ok {
+		t.Fatal("soft delete must keep the row until purge")
+	}
+	if _, err := s.Get(user.GUID.String()); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("get deleted user: err = %v", err)
+	}
+	if _, err := s.RefreshTokens(tokens.AccessToken, tokens.RefreshToken, testClient); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("refresh of deleted user: err = %v", err)
+	}
+	if len(s.sessions.sessions) != 0 {
+		t.Errorf("sessions = %d, delete must revoke them", len(s.sessions.sessions))
+	}
+	if err := s.Delete(user.GUID.String(), user.GUID.String(), testClient); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("second delete: err = %v", err)
+	}
+	if err := s.SignUp(user.Email, testClient); err != nil {
+		t.Errorf("email of a deleted user must be free: %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+
+	s := newTestUserService(t)
+	recent := s.addUser(t, domain.RoleUser)
+	old := s.addUser(t, domain.RoleUser)
+	active := s.addUser(t, domain.RoleUser)
+	for _, user := range []*domain.User{recent, old} {
+		if err := s.users.DeleteUser(user.GUID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.users.deletedAt[old.GUID] = time.Now().Add(-48 * time.Hour)
+
+	live, err := s.issueTokens(active, auth.CustomClaims{IP: testClient.IP}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := s.issueTokens(active, auth.CustomClaims{IP: testClient.IP}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredID := sessionID(t, s, expired.AccessToken)
+	session := s.sessions.sessions[expiredID]
+	session.ExpiresAt = time.Now().Add(-time.Second)
+	s.sessions.sessions[expiredID] = session
+
+	s.purge(24 * time.Hour)
+
+	if _, ok := s.users.users[old.GUID]; ok {
+		t.Error("user deleted before the retention period must be purged")
+	}
+	if _, ok := s.users.users[recent.GUID]; !ok {
+		t.Error("recently deleted user must be kept")
+	}
+	if _, ok := s.users.users[active.GUID]; !ok {
+		t.Error("active user must be kept")
+	}
+	if _, ok := s.sessions.sessions[expiredID]; ok {
+		t.Error("expired session must be purged")
+	}
+	if _, ok := s.sessions.sessions[sessionID(t, s, live.AccessToken)]; !ok {
+		t.Error("live session must be kept")
+	}
+}
+
+// racingUserRepository меняет пользователя перед условным обновлением, как параллельный запрос
+// между чтением и записью в сервисе.
+type racingUserRepository struct {
+	*fakeUserRepository
+	race func(guid uuid.UUID)
+}
+
+func (r *racingUserRepository) SetPendingEmail(guid uuid.UUID, email, tokenHash string, expiry time.Time) error {
+	r.race(guid)
+	return r.fakeUserRepository.SetPendingEmail(guid, email, tokenHash, expiry)
+}
+
+func TestUpdateErrorAfterConcurrentChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		race    func(repo *fakeUserRepository, guid uuid.UUID)
+		wantErr error
+	}{
+		{
+			name:    "disabled meanwhile",
+			race:    func(repo *fakeUserRepository, guid uuid.UUID) { _ = repo.SetStatus(guid, domain.UserStatusDisabled) },
+			wantErr: ErrAccountDisabled,
+		},
+		{
+			name:    "deleted meanwhile",
+			race:    func(repo *fakeUserRepository, guid uuid.UUID) { _ = repo.DeleteUser(guid) },
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:    "purged meanwhile",
+			race:    func(repo *fakeUserRepository, guid uuid.UUID) { delete(repo.users, guid) },
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUserService(t)
+			user := s.addUser(t, domain.RoleUser)
+			s.repo = &racingUserRepository{fakeUserRepository: s.users, race: func(guid uuid.UUID) { tt.race(s.users, guid) }}
+
+			if _, err := s.RequestEmailChange(user.GUID.String(), "new@example.com", testClient); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
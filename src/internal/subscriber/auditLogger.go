@@ -0,0 +1,22 @@
+package subscriber
+
+import (
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+type AuditLogger struct{}
+
+func NewAuditLogger() *AuditLogger {
+	return &AuditLogger{}
+}
+
+func (a *AuditLogger) Register(bus event.BusInterface) {
+	bus.SubscribeAll(a.onEvent)
+}
+
+func (a *AuditLogger) onEvent(e event.Event) error {
+	logger.Log.WithFields(logrus.Fields{"event": e.Name(), "payload": e}).Infoln("audit")
+	return nil
+}
@@ -0,0 +1,64 @@
+package subscriber
+
+import (
+	"JwtTestTask/src/internal/event"
+	"JwtTestTask/src/pkg/mail"
+	"fmt"
+	"time"
+)
+
+// queueSize — сколько событий подписчик с сетевыми вызовами может отложить, прежде чем начнёт их отбрасывать.
+const queueSize = 256
+
+type EmailNotifier struct {
+	sender mail.SenderInterface
+	queue  *event.Queue
+}
+
+func NewEmailNotifier(sender mail.SenderInterface) *EmailNotifier {
+	return &EmailNotifier{sender: sender, queue: event.NewQueue(queueSize)}
+}
+
+// Register подписывает обработчики через очередь: письмо отправляется после ответа на запрос.
+func (n *EmailNotifier) Register(bus event.BusInterface) {
+	bus.Subscribe(event.SuspiciousIPDetectedName, n.queue.Async(n.onSuspiciousIP))
+	bus.Subscribe(event.AccountLockedName, n.queue.Async(n.onAccountLocked))
+	bus.Subscribe(event.EmailChangeRequestedName, n.queue.Async(n.onEmailChangeRequested))
+}
+
+func (n *EmailNotifier) onSuspiciousIP(e event.Event) error {
+	suspicious, ok := e.(event.SuspiciousIPDetected)
+	if !ok {
+		return fmt.Errorf("unexpected event type %T", e)
+	}
+	subject := "IP Address Change Warning"
+	body := "Your IP address has changed from " + suspicious.OldIP + " to " + suspicious.NewIP + "."
+	return n.send(suspicious.Email, subject, body)
+}
+
+func (n *EmailNotifier) onAccountLocked(e event.Event) error {
+	locked, ok := e.(event.AccountLocked)
+	if !ok {
+		return fmt.Errorf("unexpected event type %T", e)
+	}
+	subject := "Session Locked"
+	body := "One of your sessions has been locked until " + locked.LockedUntil.UTC().Format(time.RFC1123) +
+		" after too many failed token refresh attempts from " + locked.IP + ". Your other sessions are not affected."
+	return n.send(locked.Email, subject, body)
+}
+
+// onEmailChangeRequested предупреждает владельца по старому адресу. Код подтверждения на новый адрес
+// отправляет сам UserService: секрет не публикуется в шине.
+func (n *EmailNotifier) onEmailChangeRequested(e event.Event) error {
+	requested, ok := e.(event.EmailChangeRequested)
+	if !ok {
+		return fmt.Errorf("unexpected event type %T", e)
+	}
+	noticeBody := "A change of your account email to " + requested.NewEmail + " was requested from " + requested.IP +
+		". If it wasn't you, sign in and secure your account: the email is not changed until the new address is confirmed."
+	return n.send(requested.OldEmail, "Email Change Requested", noticeBody)
+}
+
+func (n *EmailNotifier) send(email, subject, body string) error {
+	return n.sender.Send(email, subject, body)
+}
@@ -0,0 +1,36 @@
+package subscriber
+
+import (
+	"JwtTestTask/src/internal/event"
+	"sync"
+)
+
+type Metrics struct {
+	mu       sync.RWMutex
+	counters map[string]int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{counters: make(map[string]int64)}
+}
+
+func (m *Metrics) Register(bus event.BusInterface) {
+	bus.SubscribeAll(m.onEvent)
+}
+
+func (m *Metrics) onEvent(e event.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[e.Name()]++
+	return nil
+}
+
+func (m *Metrics) Snapshot() map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := make(map[string]int64, len(m.counters))
+	for name, count := range m.counters {
+		snapshot[name] = count
+	}
+	return snapshot
+}
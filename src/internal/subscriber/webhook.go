@@ -0,0 +1,51 @@
+package subscriber
+
+import (
+	"JwtTestTask/src/internal/event"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Webhook struct {
+	url    string
+	client *http.Client
+	queue  *event.Queue
+}
+
+type webhookPayload struct {
+	Event   string      `json:"event"`
+	Payload event.Event `json:"payload"`
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 5 * time.Second}, queue: event.NewQueue(queueSize)}
+}
+
+func (w *Webhook) Register(bus event.BusInterface) {
+	bus.SubscribeAll(w.queue.Async(w.onEvent))
+}
+
+func (w *Webhook) onEvent(e event.Event) error {
+	body, err := json.Marshal(webhookPayload{Event: e.Name(), Payload: e})
+	if err != nil {
+		return err
+	}
+
+	return w.send(body)
+}
+
+func (w *Webhook) send(body []byte) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
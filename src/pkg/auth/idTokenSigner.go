@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"os"
+	"time"
+)
+
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	jwt.StandardClaims
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// IDTokenSigner подписывает ID токены и access token для других сервисов асимметричным ключом (RS256):
+// в отличие от собственных access token, их проверяют сторонние клиенты по опубликованному JWKS,
+// не зная секрета сервиса.
+type IDTokenSigner struct {
+	key    *rsa.PrivateKey
+	keyID  string
+	issuer string
+}
+
+type IDTokenSignerInterface interface {
+	NewIDToken(claims IDTokenClaims, duration time.Duration) (string, error)
+	NewAccessToken(claims CustomClaims, duration time.Duration) (string, error)
+	ParseIDToken(idToken string) (*IDTokenClaims, error)
+	JWKS() JSONWebKeySet
+	Issuer() string
+}
+
+// NewIDTokenSigner загружает RSA ключ в PEM (PKCS#1 или PKCS#8). Если путь не задан,
+// генерируется временный ключ: выданные ID токены перестанут проверяться после перезапуска.
+func NewIDTokenSigner(keyPath string, issuer string) (*IDTokenSigner, error) {
+	if issuer == "" {
+		return nil, errors.New("empty issuer")
+	}
+
+	var key *rsa.PrivateKey
+	var err error
+	if keyPath == "" {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = loadRSAKey(keyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+
+	return &IDTokenSigner{key: key, keyID: base64.RawURLEncoding.EncodeToString(sum[:12]), issuer: issuer}, nil
+}
+
+func (s *IDTokenSigner) Issuer() string {
+	return s.issuer
+}
+
+func (s *IDTokenSigner) NewIDToken(claims IDTokenClaims, duration time.Duration) (string, error) {
+	now := time.Now()
+	claims.Issuer = s.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(duration).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.key)
+}
+
+// NewAccessToken подписывает access token, выданный обменом для другого сервиса (aud). Сам сервис такие
+// токены не принимает: JwtManager.Parse проверяет только HS512.
+func (s *IDTokenSigner) NewAccessToken(claims CustomClaims, duration time.Duration) (string, error) {
+	now := time.Now()
+	claims.Issuer = s.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(duration).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.key)
+}
+
+// ParseIDToken проверяет подпись и issuer, но допускает истёкший токен: так id_token_hint
+// из end session запроса остаётся пригодным после окончания срока жизни.
+func (s *IDTokenSigner) ParseIDToken(idToken string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return &s.key.PublicKey, nil
+	})
+	var validationErr *jwt.ValidationError
+	if err != nil && !(errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired) {
+		return nil, err
+	}
+	if claims.Issuer != s.issuer {
+		return nil, errors.New("unexpected issuer")
+	}
+	return claims, nil
+}
+
+func (s *IDTokenSigner) JWKS() JSONWebKeySet {
+	return JSONWebKeySet{Keys: []JSONWebKey{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: s.keyID,
+		N:   base64.RawURLEncoding.EncodeToString(s.key.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.PublicKey.E)).Bytes()),
+	}}}
+}
+
+func loadRSAKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM in " + path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return key, nil
+}
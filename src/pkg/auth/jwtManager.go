@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha512"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -11,23 +13,59 @@ import (
 
 type JwtManager struct {
 	signingKey      string
+	issuer          string
 	AccessDuration  time.Duration
 	RefreshDuration time.Duration
 }
 
 type CustomClaims struct {
-	IP string `json:"ip"`
+	IP       string        `json:"ip"`
+	Role     string        `json:"role,omitempty"`
+	Scope    string        `json:"scope,omitempty"`
+	ClientID string        `json:"client_id,omitempty"`
+	Act      *ActorClaims  `json:"act,omitempty"`
+	Cnf      *Confirmation `json:"cnf,omitempty"`
+	// SessionID — refresh сессия, в которой выдан access token. Обновить токены можно только в ней.
+	SessionID string `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
 
+// Confirmation — claim cnf (RFC 7800): ключ, которым клиент обязан подтверждать владение токеном.
+// JKT — thumbprint ключа DPoP (RFC 9449), X5T — thumbprint клиентского TLS сертификата (RFC 8705).
+type Confirmation struct {
+	JKT string `json:"jkt,omitempty"`
+	X5T string `json:"x5t#S256,omitempty"`
+}
+
+// ActorClaims — claim act из RFC 8693: кто действует от имени subject. Вложенный Act
+// сохраняет цепочку предыдущих делегирований.
+type ActorClaims struct {
+	Subject  string       `json:"sub"`
+	ClientID string       `json:"client_id,omitempty"`
+	Act      *ActorClaims `json:"act,omitempty"`
+}
+
 type JwtManagerInterface interface {
-	NewAccessToken(guid string, ip string) (string, error)
+	NewAccessToken(guid string, ip string, role string) (string, error)
+	NewAccessTokenWithClaims(claims CustomClaims, duration time.Duration) (string, error)
 	NewRefreshToken() (string, error)
 	Parse(accessToken string) (*CustomClaims, error)
+	GetAccessDuration() time.Duration
 	GetRefreshDuration() time.Duration
 }
 
-func NewManager(signingKey string, jwtDuration time.Duration, refreshDuration time.Duration) (*JwtManager, error) {
+// TokenParserInterface проверяет токен из заголовка Authorization. Кроме JwtManager его реализуют
+// аутентификаторы, принимающие другие виды токенов.
+type TokenParserInterface interface {
+	Parse(token string) (*CustomClaims, error)
+}
+
+type SignerInterface interface {
+	Sign(data []byte) string
+	Verify(data []byte, signature string) bool
+}
+
+func NewManager(signingKey string, issuer string, jwtDuration time.Duration, refreshDuration time.Duration) (*JwtManager, error) {
 	if signingKey == "" {
 		return nil, errors.New("empty signing key")
 	}
@@ -37,22 +75,36 @@ func NewManager(signingKey string, jwtDuration time.Duration, refreshDuration ti
 	if refreshDuration <= 0 {
 		return nil, errors.New("invalid RefreshDuration")
 	}
-	return &JwtManager{signingKey: signingKey, AccessDuration: jwtDuration, RefreshDuration: refreshDuration}, nil
+	return &JwtManager{signingKey: signingKey, issuer: issuer, AccessDuration: jwtDuration, RefreshDuration: refreshDuration}, nil
+}
+
+func (m *JwtManager) GetAccessDuration() time.Duration {
+	return m.AccessDuration
 }
 
 func (m *JwtManager) GetRefreshDuration() time.Duration {
 	return m.RefreshDuration
 }
 
-func (m *JwtManager) NewAccessToken(guid string, ip string) (string, error) {
+func (m *JwtManager) NewAccessToken(guid string, ip string, role string) (string, error) {
 	claims := CustomClaims{
-		IP: ip,
+		IP:   ip,
+		Role: role,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(m.AccessDuration).Unix(),
-			Subject:   guid,
+			Subject: guid,
 		},
 	}
 
+	return m.NewAccessTokenWithClaims(claims, m.AccessDuration)
+}
+
+func (m *JwtManager) NewAccessTokenWithClaims(claims CustomClaims, duration time.Duration) (string, error) {
+	now := time.Now()
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now.Unix()
+	}
+	claims.ExpiresAt = now.Add(duration).Unix()
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
 	return token.SignedString([]byte(m.signingKey))
 }
@@ -68,7 +120,8 @@ func (m *JwtManager) NewRefreshToken() (string, error) {
 }
 
 func (m *JwtManager) Parse(accessToken string) (*CustomClaims, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+	claims := &CustomClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
@@ -77,19 +130,26 @@ func (m *JwtManager) Parse(accessToken string) (*CustomClaims, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("error getting user claims from token: %v", token.Claims)
+	// Токен, выданный обменом для другого сервиса (aud), у нас не принимается.
+	if claims.Audience != "" && claims.Audience != m.issuer {
+		return nil, errors.New("token is issued for another audience")
 	}
 
-	customClaims := &CustomClaims{
-		IP: claims["ip"].(string),
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: int64(claims["exp"].(float64)),
-			Subject:   claims["sub"].(string),
-		},
-	}
+	return claims, nil
+}
+
+func (m *JwtManager) Sign(data []byte) string {
+	mac := hmac.New(sha512.New, []byte(m.signingKey))
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
 
-	return customClaims, nil
+func (m *JwtManager) Verify(data []byte, signature string) bool {
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha512.New, []byte(m.signingKey))
+	mac.Write(data)
+	return hmac.Equal(mac.Sum(nil), expected)
 }
@@ -3,10 +3,14 @@ package config
 import (
 	db "JwtTestTask/src/pkg/database"
 	"JwtTestTask/src/pkg/logger"
+	"JwtTestTask/src/pkg/ratelimit"
+	"JwtTestTask/src/pkg/sso"
 	"github.com/joho/godotenv"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,12 +18,80 @@ type ServerParams struct {
 	ServerHost string
 }
 
+type TLSParams struct {
+	CertFile          string
+	KeyFile           string
+	ClientCAFile      string
+	RequireClientCert bool
+}
+
 type JwtParams struct {
 	SigningKey      string
 	AccessDuration  time.Duration
 	RefreshDuration time.Duration
 }
 
+type AuditParams struct {
+	CheckpointInterval time.Duration
+}
+
+// RetentionParams задаёт, сколько хранятся мягко удалённые пользователи и как часто их удалять окончательно.
+type RetentionParams struct {
+	UserRetention time.Duration
+	PurgeInterval time.Duration
+}
+
+type RateLimitParams struct {
+	IP      ratelimit.Rule
+	Account ratelimit.Rule
+	Global  ratelimit.Rule
+}
+
+type LockoutParams struct {
+	MaxAttempts  int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+type OIDCParams struct {
+	Issuer          string
+	PrivateKeyPath  string
+	IDTokenDuration time.Duration
+}
+
+type CookieParams struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	MaxAge   time.Duration
+}
+
+// TokenTransportParams.BodyFallback разрешает передавать токены в /refresh в JSON body, как
+// до появления заголовков. Отключается, когда все клиенты перешли на заголовки.
+type TokenTransportParams struct {
+	BodyFallback bool
+}
+
+// LegacyRoutesParams управляет маршрутами без префикса /api/v1. Sunset может быть не задан.
+type LegacyRoutesParams struct {
+	Enabled      bool
+	DeprecatedAt time.Time
+	Sunset       time.Time
+}
+
+type DPoPParams struct {
+	ProofWindow time.Duration
+}
+
+type WebhookParams struct {
+	URL string
+}
+
+// MetricsParams.Enabled включает /metrics. Эндпоинт в любом случае доступен только администратору.
+type MetricsParams struct {
+	Enabled bool
+}
+
 type SmtParams struct {
 	Host     string
 	Port     string
@@ -30,13 +102,13 @@ type SmtParams struct {
 func Init() {
 	rootDir, err := os.Getwd()
 	if err != nil {
-		logger.Log.Fatal("Ошибка при получении текущей директории: %v", err)
+		logger.Log.Fatalf("Ошибка при получении текущей директории: %v", err)
 	}
 
 	envFilePath := filepath.Join(filepath.Dir(filepath.Dir(rootDir)), ".env")
 	envErr := godotenv.Load(envFilePath)
 	if envErr != nil {
-		logger.Log.Fatal("Ошибка при загрузке .env файла: %v", envErr)
+		logger.Log.Fatalf("Ошибка при загрузке .env файла: %v", envErr)
 	}
 }
 
@@ -65,6 +137,16 @@ func GetServerParams() ServerParams {
 	return ServerParams{ServerHost: serverHost}
 }
 
+// GetTLSParams возвращает пути к сертификатам. Без TLS_CERT_FILE сервер работает по http.
+func GetTLSParams() TLSParams {
+	return TLSParams{
+		CertFile:          os.Getenv("TLS_CERT_FILE"),
+		KeyFile:           os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:      os.Getenv("TLS_CLIENT_CA_FILE"),
+		RequireClientCert: os.Getenv("TLS_REQUIRE_CLIENT_CERT") == "true",
+	}
+}
+
 func GetJwtParams() JwtParams {
 	AccessDurationStr := os.Getenv("JWT_ACCESS_DURATION")
 	RefreshDurationStr := os.Getenv("JWT_REFRESH_DURATION")
@@ -104,3 +186,195 @@ func GetSmtpParams() SmtParams {
 
 	return smtParams
 }
+
+func GetWebhookParams() WebhookParams {
+	return WebhookParams{URL: os.Getenv("WEBHOOK_URL")}
+}
+
+// GetCookieParams возвращает настройки cookie для браузерных клиентов. Срок жизни refresh cookie
+// совпадает со сроком жизни refresh token.
+func GetCookieParams(refreshDuration time.Duration) CookieParams {
+	sameSite := http.SameSiteStrictMode
+	switch strings.ToLower(os.Getenv("COOKIE_SAME_SITE")) {
+	case "", "strict":
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		logger.Log.Printf("Некорректное значение COOKIE_SAME_SITE. Используется значение по умолчанию: strict.")
+	}
+
+	return CookieParams{
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		Secure:   os.Getenv("COOKIE_SECURE") != "false",
+		SameSite: sameSite,
+		MaxAge:   refreshDuration,
+	}
+}
+
+func GetTokenTransportParams() TokenTransportParams {
+	return TokenTransportParams{BodyFallback: os.Getenv("REFRESH_BODY_FALLBACK") != "false"}
+}
+
+// legacyRoutesDeprecatedAt — дата выхода /api/v1, с которой старые маршруты считаются устаревшими.
+const legacyRoutesDeprecatedAt = "2026-10-19T00:00:00Z"
+
+func GetLegacyRoutesParams() LegacyRoutesParams {
+	deprecatedAt, err := time.Parse(time.RFC3339, os.Getenv("LEGACY_ROUTES_DEPRECATED_AT"))
+	if err != nil {
+		deprecatedAt, _ = time.Parse(time.RFC3339, legacyRoutesDeprecatedAt)
+	}
+
+	var sunset time.Time
+	if sunsetStr := os.Getenv("LEGACY_ROUTES_SUNSET"); sunsetStr != "" {
+		sunset, err = time.Parse(time.RFC3339, sunsetStr)
+		if err != nil {
+			logger.Log.Printf("Параметр LEGACY_ROUTES_SUNSET некорректен и не будет использован: %v", err)
+		}
+	}
+
+	return LegacyRoutesParams{
+		Enabled:      os.Getenv("LEGACY_ROUTES_ENABLED") != "false",
+		DeprecatedAt: deprecatedAt,
+		Sunset:       sunset,
+	}
+}
+
+func GetMetricsParams() MetricsParams {
+	return MetricsParams{Enabled: os.Getenv("METRICS_ENABLED") != "false"}
+}
+
+func GetDPoPParams() DPoPParams {
+	return DPoPParams{ProofWindow: time.Duration(getIntOrDefault("DPOP_PROOF_WINDOW", 60)) * time.Second}
+}
+
+func GetAuditParams() AuditParams {
+	intervalStr := os.Getenv("AUDIT_CHECKPOINT_INTERVAL")
+	intervalInt, err := strconv.Atoi(intervalStr)
+	if err != nil || intervalInt <= 0 {
+		intervalInt = 60
+		logger.Log.Printf("Параметр AUDIT_CHECKPOINT_INTERVAL не задан или некорректен. Используется значение по умолчанию: %d минут.", intervalInt)
+	}
+
+	return AuditParams{CheckpointInterval: time.Duration(intervalInt) * time.Minute}
+}
+
+func GetRateLimitParams() RateLimitParams {
+	return RateLimitParams{
+		IP:      getRateLimitRule("RATE_LIMIT_IP", 30, 10),
+		Account: getRateLimitRule("RATE_LIMIT_ACCOUNT", 10, 5),
+		Global:  getRateLimitRule("RATE_LIMIT_GLOBAL", 1000, 200),
+	}
+}
+
+func getRateLimitRule(prefix string, defaultPerMinute, defaultBurst int) ratelimit.Rule {
+	perMinute := getIntOrDefault(prefix+"_PER_MINUTE", defaultPerMinute)
+	burst := getIntOrDefault(prefix+"_BURST", defaultBurst)
+	return ratelimit.PerMinute(perMinute, burst)
+}
+
+// getPositiveIntOrDefault — getIntOrDefault, который заменяет нулевые и отрицательные значения значением по умолчанию.
+func getPositiveIntOrDefault(key string, defaultValue int) int {
+	value := getIntOrDefault(key, defaultValue)
+	if value <= 0 {
+		logger.Log.Printf("Параметр %s должен быть положительным. Используется значение по умолчанию: %d.", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getIntOrDefault(key string, defaultValue int) int {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		logger.Log.Printf("Ошибка при преобразовании %s: %v. Используется значение по умолчанию: %d.", key, err, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func GetLockoutParams() LockoutParams {
+	params := LockoutParams{
+		MaxAttempts:  getPositiveIntOrDefault("LOCKOUT_MAX_ATTEMPTS", 5),
+		BaseDuration: time.Duration(getPositiveIntOrDefault("LOCKOUT_BASE_DURATION", 15)) * time.Minute,
+		MaxDuration:  time.Duration(getPositiveIntOrDefault("LOCKOUT_MAX_DURATION", 1440)) * time.Minute,
+	}
+	if params.BaseDuration > params.MaxDuration {
+		logger.Log.Printf("LOCKOUT_BASE_DURATION больше LOCKOUT_MAX_DURATION. Используются значения по умолчанию: 15 и 1440 минут.")
+		params.BaseDuration = 15 * time.Minute
+		params.MaxDuration = 1440 * time.Minute
+	}
+	return params
+}
+
+func GetRetentionParams() RetentionParams {
+	retentionInt, err := strconv.Atoi(os.Getenv("USER_RETENTION_DAYS"))
+	if err != nil || retentionInt <= 0 {
+		retentionInt = 30
+		logger.Log.Printf("Параметр USER_RETENTION_DAYS не задан или некорректен. Используется значение по умолчанию: %d дней.", retentionInt)
+	}
+
+	intervalInt, err := strconv.Atoi(os.Getenv("USER_PURGE_INTERVAL"))
+	if err != nil || intervalInt <= 0 {
+		intervalInt = 60
+		logger.Log.Printf("Параметр USER_PURGE_INTERVAL не задан или некорректен. Используется значение по умолчанию: %d минут.", intervalInt)
+	}
+
+	return RetentionParams{
+		UserRetention: time.Duration(retentionInt) * 24 * time.Hour,
+		PurgeInterval: time.Duration(intervalInt) * time.Minute,
+	}
+}
+
+func GetOIDCParams() OIDCParams {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		issuer = "http://localhost:8080"
+		logger.Log.Printf("Параметр OIDC_ISSUER не задан. Используется значение по умолчанию: %s.", issuer)
+	}
+
+	privateKeyPath := os.Getenv("OIDC_PRIVATE_KEY_PATH")
+	if privateKeyPath == "" {
+		logger.Log.Warnln("Параметр OIDC_PRIVATE_KEY_PATH не задан. ID токены подписываются временным ключом и станут недействительны после перезапуска.")
+	}
+
+	return OIDCParams{
+		Issuer:          strings.TrimSuffix(issuer, "/"),
+		PrivateKeyPath:  privateKeyPath,
+		IDTokenDuration: time.Duration(getIntOrDefault("OIDC_ID_TOKEN_DURATION", 15)) * time.Minute,
+	}
+}
+
+// GetSSOParams читает внешних OIDC провайдеров: SSO_PROVIDERS=corp,google и для каждого
+// SSO_<NAME>_DISCOVERY_URL, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL, опционально _SCOPES.
+func GetSSOParams() []sso.ProviderConfig {
+	var providers []sso.ProviderConfig
+	for _, name := range strings.Split(os.Getenv("SSO_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "SSO_" + strings.ToUpper(name) + "_"
+		provider := sso.ProviderConfig{
+			Name:         name,
+			DiscoveryURL: os.Getenv(prefix + "DISCOVERY_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.DiscoveryURL == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			logger.Log.Fatalf("Ошибка: не все параметры SSO провайдера %s были получены. Проверьте .env файл.", name)
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
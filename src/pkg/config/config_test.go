@@ -0,0 +1,51 @@
+package config
+
+import (
+	"JwtTestTask/src/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestGetLockoutParams(t *testing.T) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want LockoutParams
+	}{
+		{
+			name: "defaults",
+			want: LockoutParams{MaxAttempts: 5, BaseDuration: 15 * time.Minute, MaxDuration: 1440 * time.Minute},
+		},
+		{
+			name: "custom values",
+			env:  map[string]string{"LOCKOUT_MAX_ATTEMPTS": "3", "LOCKOUT_BASE_DURATION": "5", "LOCKOUT_MAX_DURATION": "60"},
+			want: LockoutParams{MaxAttempts: 3, BaseDuration: 5 * time.Minute, MaxDuration: 60 * time.Minute},
+		},
+		{
+			name: "non-positive values fall back to defaults",
+			env:  map[string]string{"LOCKOUT_MAX_ATTEMPTS": "0", "LOCKOUT_BASE_DURATION": "-5", "LOCKOUT_MAX_DURATION": "abc"},
+			want: LockoutParams{MaxAttempts: 5, BaseDuration: 15 * time.Minute, MaxDuration: 1440 * time.Minute},
+		},
+		{
+			name: "base longer than max falls back to defaults",
+			env:  map[string]string{"LOCKOUT_BASE_DURATION": "120", "LOCKOUT_MAX_DURATION": "60"},
+			want: LockoutParams{MaxAttempts: 5, BaseDuration: 15 * time.Minute, MaxDuration: 1440 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"LOCKOUT_MAX_ATTEMPTS", "LOCKOUT_BASE_DURATION", "LOCKOUT_MAX_DURATION"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := GetLockoutParams(); got != tt.want {
+				t.Errorf("GetLockoutParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -22,7 +22,7 @@ func NewClient(dbModel DbInitModel) *gorm.DB {
 		" port=" + dbModel.DbPort +
 		" sslmode=disable"
 
-	db, dbErr := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, dbErr := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if dbErr != nil {
 		logger.Log.Fatal("Failed to connect to database")
 	}
@@ -0,0 +1,168 @@
+package dpop
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const proofType = "dpop+jwt"
+
+// SupportedAlgorithms публикуется в метаданных OIDC как dpop_signing_alg_values_supported.
+var SupportedAlgorithms = []string{"ES256", "RS256", "PS256"}
+
+// JWK — публичный ключ из заголовка DPoP proof. Поддерживаются EC P-256 и RSA.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type proofClaims struct {
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+	jwt.StandardClaims
+}
+
+// Verifier проверяет DPoP proof по RFC 9449: подпись ключом из заголовка jwk, метод и URL
+// запроса, свежесть iat и однократность jti.
+type Verifier struct {
+	replay ReplayStore
+	window time.Duration
+}
+
+type VerifierInterface interface {
+	Verify(proof, method, requestURL, accessToken string) (string, error)
+}
+
+func NewVerifier(replay ReplayStore, window time.Duration) *Verifier {
+	return &Verifier{replay: replay, window: window}
+}
+
+// Verify возвращает thumbprint (jkt) ключа, которым подписан proof. Если передан accessToken,
+// proof должен содержать его хеш в ath.
+func (v *Verifier) Verify(proof, method, requestURL, accessToken string) (string, error) {
+	var key JWK
+	claims := &proofClaims{}
+	parser := &jwt.Parser{ValidMethods: SupportedAlgorithms, SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, errors.New("invalid dpop proof type")
+		}
+		raw, err := json.Marshal(token.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return nil, errors.New("invalid dpop proof jwk")
+		}
+		return key.PublicKey()
+	})
+	if err != nil {
+		return "", errors.New("invalid dpop proof: " + err.Error())
+	}
+
+	if claims.HTM != method {
+		return "", errors.New("dpop proof htm does not match request method")
+	}
+	if !sameURL(claims.HTU, requestURL) {
+		return "", errors.New("dpop proof htu does not match request url")
+	}
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	now := time.Now()
+	if issuedAt.Before(now.Add(-v.window)) || issuedAt.After(now.Add(v.window)) {
+		return "", errors.New("dpop proof iat is outside the acceptable window")
+	}
+	if claims.Id == "" {
+		return "", errors.New("dpop proof jti is required")
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(hash[:]) {
+			return "", errors.New("dpop proof ath does not match access token")
+		}
+	}
+
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		return "", err
+	}
+	// jti уникален в пределах ключа, поэтому в кеш попадает пара jkt + jti
+	if v.replay.Seen(thumbprint+":"+claims.Id, issuedAt.Add(2*v.window)) {
+		return "", errors.New("dpop proof has already been used")
+	}
+	return thumbprint, nil
+}
+
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, errors.New("unsupported jwk curve")
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid jwk coordinates")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid jwk coordinates")
+		}
+		return key, nil
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid jwk modulus or exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, errors.New("unsupported jwk key type")
+	}
+}
+
+// Thumbprint вычисляет JWK thumbprint по RFC 7638: sha256 от обязательных членов ключа
+// в лексикографическом порядке без пробелов.
+func (k JWK) Thumbprint() (string, error) {
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		canonical = `{"crv":"` + k.Crv + `","kty":"EC","x":"` + k.X + `","y":"` + k.Y + `"}`
+	case "RSA":
+		canonical = `{"e":"` + k.E + `","kty":"RSA","n":"` + k.N + `"}`
+	default:
+		return "", errors.New("unsupported jwk key type")
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// sameURL сравнивает htu с URL запроса без query и fragment, как требует RFC 9449.
+func sameURL(htu, requestURL string) bool {
+	proofURL, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	actualURL, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(proofURL.Scheme, actualURL.Scheme) &&
+		strings.EqualFold(proofURL.Host, actualURL.Host) &&
+		proofURL.EscapedPath() == actualURL.EscapedPath()
+}
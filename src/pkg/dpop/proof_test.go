@@ -0,0 +1,228 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testMethod = "POST"
+	testURL    = "https://auth.example.com/api/v1/auth/refresh"
+	testWindow = time.Minute
+)
+
+func ecJWK(key *ecdsa.PrivateKey) JWK {
+	return JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func rsaJWK(key *rsa.PrivateKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// testProof — параметры proof, которые меняют случаи теста. По умолчанию proof корректен.
+type testProof struct {
+	method jwt.SigningMethod
+	key    interface{}
+	jwk    interface{}
+	typ    string
+	claims proofClaims
+}
+
+func newTestProof(t *testing.T) *testProof {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testProof{
+		method: jwt.SigningMethodES256,
+		key:    key,
+		jwk:    ecJWK(key),
+		typ:    proofType,
+		claims: proofClaims{HTM: testMethod, HTU: testURL, StandardClaims: jwt.StandardClaims{Id: "jti-1", IssuedAt: time.Now().Unix()}},
+	}
+}
+
+func (p *testProof) sign(t *testing.T) string {
+	t.Helper()
+	token := jwt.NewWithClaims(p.method, p.claims)
+	token.Header["typ"] = p.typ
+	token.Header["jwk"] = p.jwk
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(p *testProof)
+		requestURL  string
+		accessToken string
+		wantErr     string
+	}{
+		{name: "valid es256 proof", modify: func(p *testProof) {}},
+		{
+			name:   "valid rs256 proof",
+			modify: func(p *testProof) { p.method, p.key, p.jwk = jwt.SigningMethodRS256, rsaKey, rsaJWK(rsaKey) },
+		},
+		{
+			name:       "query and fragment are ignored",
+			modify:     func(p *testProof) { p.claims.HTU = testURL + "?a=1#f" },
+			requestURL: "https://AUTH.example.com/api/v1/auth/refresh?b=2",
+		},
+		{
+			name:        "access token hash",
+			modify:      func(p *testProof) { p.claims.ATH = accessTokenHash("access-token") },
+			accessToken: "access-token",
+		},
+		{
+			name:        "access token hash mismatch",
+			modify:      func(p *testProof) { p.claims.ATH = accessTokenHash("other-token") },
+			accessToken: "access-token",
+			wantErr:     "dpop proof ath does not match access token",
+		},
+		{
+			name:        "missing access token hash",
+			modify:      func(p *testProof) {},
+			accessToken: "access-token",
+			wantErr:     "dpop proof ath does not match access token",
+		},
+		{name: "wrong typ", modify: func(p *testProof) { p.typ = "JWT" }, wantErr: "invalid dpop proof type"},
+		{name: "signed by another key", modify: func(p *testProof) { p.jwk = ecJWK(otherKey) }, wantErr: "invalid dpop proof"},
+		{name: "symmetric algorithm", modify: func(p *testProof) { p.method, p.key = jwt.SigningMethodHS256, []byte("secret") }, wantErr: "invalid dpop proof"},
+		{
+			name: "unsupported curve",
+			modify: func(p *testProof) {
+				jwk := p.jwk.(JWK)
+				jwk.Crv = "P-384"
+				p.jwk = jwk
+			},
+			wantErr: "unsupported jwk curve",
+		},
+		{name: "missing jwk", modify: func(p *testProof) { p.jwk = nil }, wantErr: "unsupported jwk key type"},
+		{name: "wrong method", modify: func(p *testProof) { p.claims.HTM = "GET" }, wantErr: "dpop proof htm does not match request method"},
+		{
+			name:    "wrong host",
+			modify:  func(p *testProof) { p.claims.HTU = "https://evil.example.com/api/v1/auth/refresh" },
+			wantErr: "dpop proof htu does not match request url",
+		},
+		{
+			name:    "wrong path",
+			modify:  func(p *testProof) { p.claims.HTU = "https://auth.example.com/api/v1/auth/login" },
+			wantErr: "dpop proof htu does not match request url",
+		},
+		{
+			name:    "issued too long ago",
+			modify:  func(p *testProof) { p.claims.IssuedAt = time.Now().Add(-2 * testWindow).Unix() },
+			wantErr: "dpop proof iat is outside the acceptable window",
+		},
+		{
+			name:    "issued in the future",
+			modify:  func(p *testProof) { p.claims.IssuedAt = time.Now().Add(2 * testWindow).Unix() },
+			wantErr: "dpop proof iat is outside the acceptable window",
+		},
+		{name: "missing jti", modify: func(p *testProof) { p.claims.Id = "" }, wantErr: "dpop proof jti is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof := newTestProof(t)
+			tt.modify(proof)
+			requestURL := tt.requestURL
+			if requestURL == "" {
+				requestURL = testURL
+			}
+
+			verifier := NewVerifier(NewMemoryReplayStore(), testWindow)
+			thumbprint, err := verifier.Verify(proof.sign(t), testMethod, requestURL, tt.accessToken)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := proof.jwk.(JWK).Thumbprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thumbprint != want {
+				t.Errorf("thumbprint = %s, want %s", thumbprint, want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	verifier := NewVerifier(NewMemoryReplayStore(), testWindow)
+	proof := newTestProof(t)
+	signed := proof.sign(t)
+
+	if _, err := verifier.Verify(signed, testMethod, testURL, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signed, testMethod, testURL, ""); err == nil || err.Error() != "dpop proof has already been used" {
+		t.Fatalf("replayed proof: err = %v", err)
+	}
+
+	// Тот же jti другим ключом — другой proof.
+	other := newTestProof(t)
+	if _, err := verifier.Verify(other.sign(t), testMethod, testURL, ""); err != nil {
+		t.Fatalf("same jti with another key: %v", err)
+	}
+}
+
+// TestThumbprint проверяет пример из RFC 7638, раздел 3.1.
+func TestThumbprint(t *testing.T) {
+	key := JWK{
+		Kty: "RSA",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n" +
+			"91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E: "AQAB",
+	}
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint = %s", thumbprint)
+	}
+}
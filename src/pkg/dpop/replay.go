@@ -0,0 +1,44 @@
+package dpop
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayStore запоминает jti использованных proof. Для нескольких экземпляров сервиса
+// нужна реализация поверх общего хранилища.
+type ReplayStore interface {
+	// Seen отмечает jti использованным до expiresAt и сообщает, встречался ли он раньше.
+	Seen(jti string, expiresAt time.Time) bool
+}
+
+type MemoryReplayStore struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{seen: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (s *MemoryReplayStore) Seen(jti string, expiresAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for key, expiry := range s.seen {
+			if now.After(expiry) {
+				delete(s.seen, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expiry, ok := s.seen[jti]; ok && now.Before(expiry) {
+		return true
+	}
+	s.seen[jti] = expiresAt
+	return false
+}
@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"JwtTestTask/src/pkg/config"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+	// sendTimeout ограничивает весь SMTP диалог: smtp.SendMail без него может зависнуть навсегда.
+	sendTimeout = 30 * time.Second
+)
+
+// Sender отправляет письма через SMTP из параметров SMTP_*.
+type Sender struct{}
+
+type SenderInterface interface {
+	Send(email, subject, body string) error
+}
+
+func NewSender() *Sender {
+	return &Sender{}
+}
+
+// Send повторяет smtp.SendMail (STARTTLS, если сервер его поддерживает, затем PLAIN AUTH),
+// но с таймаутами на подключение и на весь диалог.
+func (s *Sender) Send(email, subject, body string) error {
+	message := []byte("Subject: " + subject + "\n\n" + body)
+
+	smtpParams := config.GetSmtpParams()
+	from := smtpParams.Username
+	host := smtpParams.Host
+	addr := net.JoinHostPort(host, smtpParams.Port)
+
+	conn, err := (&net.Dialer{Timeout: dialTimeout}).Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(sendTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if err := client.Auth(smtp.PlainAuth("", smtpParams.Username, smtpParams.Password, host)); err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(email); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,111 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate создаёт самоподписанный сертификат и ключ в PEM и возвращает пути к файлам.
+func writeCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeCertificate(t, dir)
+	emptyCA := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		clientCAFile      string
+		requireClientCert bool
+		wantClientAuth    tls.ClientAuthType
+		wantErr           bool
+	}{
+		{name: "without client ca", wantClientAuth: tls.NoClientCert},
+		{name: "required certificate without client ca", requireClientCert: true, wantErr: true},
+		{name: "optional client certificate", clientCAFile: certFile, wantClientAuth: tls.VerifyClientCertIfGiven},
+		{name: "required client certificate", clientCAFile: certFile, requireClientCert: true, wantClientAuth: tls.RequireAndVerifyClientCert},
+		{name: "client ca without certificates", clientCAFile: emptyCA, wantErr: true},
+		{name: "missing client ca file", clientCAFile: filepath.Join(dir, "missing.pem"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewServerTLSConfig(certFile, keyFile, tt.clientCAFile, tt.requireClientCert)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.ClientAuth != tt.wantClientAuth || config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("client auth = %v, min version = %x", config.ClientAuth, config.MinVersion)
+			}
+			if (config.ClientCAs != nil) != (tt.clientCAFile != "") {
+				t.Errorf("client ca pool set: %v", config.ClientCAs != nil)
+			}
+		})
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	_, _, cert := writeCertificate(t, t.TempDir())
+	sum := sha256.Sum256(cert.Raw)
+
+	if got := Thumbprint(cert); got != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("thumbprint = %s", got)
+	}
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Rule описывает token bucket: Burst токенов в ведре, пополнение со скоростью Rate токенов в секунду.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store хранит состояние ведер. MemoryStore подходит для одного экземпляра сервиса,
+// для нескольких экземпляров нужна реализация поверх общего хранилища (Redis и т.п.).
+type Store interface {
+	Take(key string, rule Rule, now time.Time) (Result, error)
+}
+
+func PerMinute(requests int, burst int) Rule {
+	return Rule{Rate: float64(requests) / 60, Burst: burst}
+}
+
+func (r Rule) Enabled() bool {
+	return r.Rate > 0 && r.Burst > 0
+}
+
+func (r Rule) durationFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / r.Rate * float64(time.Second)))
+}
@@ -0,0 +1,242 @@
+package sso
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "app"
+	testClientSecret = "secret"
+	testCode         = "code-123"
+	testVerifier     = "verifier-123"
+	testNonce        = "nonce-123"
+)
+
+// fakeIdP — минимальный OIDC провайдер: discovery, JWKS и token endpoint с проверкой PKCE.
+type fakeIdP struct {
+	t          *testing.T
+	server     *httptest.Server
+	key        *rsa.PrivateKey
+	kid        string
+	claims     jwt.MapClaims
+	jwksHits   int
+	tokenForms []url.Values
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, kid: "k1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, discoveryDocument{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JwksURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksHits++
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: idp.kid,
+			N:   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+			return
+		}
+		idp.tokenForms = append(idp.tokenForms, r.PostForm)
+		user, pass, _ := r.BasicAuth()
+		if user != testClientID || pass != testClientSecret || r.PostForm.Get("code") != testCode || r.PostForm.Get("code_verifier") != testVerifier {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id_token": idp.sign(idp.claims)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	idp.claims = jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testClientID,
+		"sub":            "external-1",
+		"email":          "user@example.com",
+		"email_verified": "true",
+		"nonce":          testNonce,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	return idp
+}
+
+func (idp *fakeIdP) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+func (idp *fakeIdP) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:         "corp",
+		DiscoveryURL: idp.server.URL + "/.well-known/openid-configuration",
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "http://localhost:8080/sso/corp/callback",
+		Scopes:       []string{"openid", "email"},
+	}, idp.server.Client())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	raw, err := idp.provider().AuthCodeURL("state-1", testNonce, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, idp.server.URL+"/authorize?") {
+		t.Fatalf("unexpected authorization endpoint: %s", raw)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	challenge := sha256.Sum256([]byte(testVerifier))
+	want := map[string]string{
+		"client_id":             testClientID,
+		"state":                 "state-1",
+		"nonce":                 testNonce,
+		"scope":                 "openid email",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestCallback(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.provider()
+
+	idToken, err := provider.Exchange(testCode, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := idp.tokenForms[0].Get("redirect_uri"); got != "http://localhost:8080/sso/corp/callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+
+	claims, err := provider.VerifyIDToken(idToken, testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "external-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	if _, err := idp.provider().Exchange(testCode, "other"); err == nil {
+		t.Fatal("expected token endpoint error")
+	}
+}
+
+func TestVerifyIDTokenRejectsNonceMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+
+	if _, err := idp.provider().VerifyIDToken(idp.sign(idp.claims), "other"); err == nil {
+		t.Fatal("expected nonce mismatch")
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.provider()
+
+	for name, value := range map[string]string{"iss": "https://evil.example.com", "aud": "other-app"} {
+		claims := jwt.MapClaims{}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		claims[name] = value
+		if _, err := provider.VerifyIDToken(idp.sign(claims), testNonce); err == nil {
+			t.Errorf("expected foreign %s to be rejected", name)
+		}
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+	token.Header["kid"] = idp.kid
+	forged, err := token.SignedString(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(forged, testNonce); err == nil {
+		t.Error("expected signature by unknown key to be rejected")
+	}
+}
+
+func TestVerifyIDTokenReloadsJWKSOnKeyRotation(t *testing.T) {
+	idp := newFakeIdP(t)
+	provider := idp.provider()
+
+	if _, err := provider.VerifyIDToken(idp.sign(idp.claims), testNonce); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.VerifyIDToken(idp.sign(idp.claims), testNonce); err != nil {
+		t.Fatal(err)
+	}
+	if idp.jwksHits != 1 {
+		t.Fatalf("jwks fetched %d times, want 1 (cached)", idp.jwksHits)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.key, idp.kid = key, "k2"
+	if _, err := provider.VerifyIDToken(idp.sign(idp.claims), testNonce); err != nil {
+		t.Fatal(err)
+	}
+	if idp.jwksHits != 2 {
+		t.Fatalf("jwks fetched %d times, want 2 after rotation", idp.jwksHits)
+	}
+}